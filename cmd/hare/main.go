@@ -0,0 +1,92 @@
+// Command hare administers Hare databases kept by the disk datastore.
+//
+// Usage:
+//
+//	hare fsck [-ext .json] [-repair] dir
+//
+// fsck checks every table file in dir and prints the problems it finds.
+// With -repair, it also mends the tables that have them, see
+// disk.Repair.  It exits with 1 if problems were found and not
+// repaired, and with 2 if the check couldn't be done.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jameycribbs/hare/datastores/disk"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+
+	switch args[0] {
+	case "fsck":
+		return fsck(args[1:], stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "hare: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: hare fsck [-ext .json] [-repair] dir")
+}
+
+func fsck(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		usage(stderr)
+		fs.PrintDefaults()
+	}
+
+	ext := fs.String("ext", ".json", "extension of the table files")
+	repair := fs.Bool("repair", false, "mend the tables with problems, quarantining the lines taken out")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	check := disk.Check
+	if *repair {
+		check = disk.Repair
+	}
+
+	report, err := check(fs.Arg(0), *ext)
+	if err != nil {
+		fmt.Fprintf(stderr, "hare: %v\n", err)
+		return 2
+	}
+
+	for _, p := range report.Problems {
+		fmt.Fprintln(stdout, p)
+	}
+
+	fmt.Fprintf(stdout, "%d tables checked, %d problems found\n", len(report.Tables), len(report.Problems))
+
+	for _, tableName := range report.Repaired {
+		fmt.Fprintf(stdout, "repaired %s\n", tableName)
+	}
+
+	if len(report.Problems) > 0 && !*repair {
+		return 1
+	}
+
+	return 0
+}
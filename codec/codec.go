@@ -0,0 +1,117 @@
+// Package codec implements the encodings hare can store records in.
+package codec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+)
+
+// ErrNoID error means an encoded record has no id field.
+var ErrNoID = errors.New("codec: record has no id field")
+
+// Codec is the interface that wraps the methods used to encode records
+// to bytes and to decode them back.  The disk datastore stores one
+// record per line, so an encoded record must not contain a newline.
+//
+// A Codec backed by a CBOR or MessagePack library can be plugged in by
+// implementing this interface.  Queries, indexes and unique constraints
+// need a Codec that can decode a record into a map[string]interface{}.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSON is the default Codec.  It encodes records with encoding/json.
+var JSON Codec = jsonCodec{}
+
+// Gob is a Codec that encodes records with encoding/gob, then with
+// base64 so that they fit on a single line.  Each record starts with a
+// "gob:" prefix, so it is never mistaken for one of the disk
+// datastore's dummy records, which start with "X".  Records written
+// without the prefix can still be decoded.  The id field of models
+// stored with Gob must be named ID.  Gob can't decode into a map, so
+// tables stored with it can't be queried by field.
+var Gob Codec = gobCodec{}
+
+// RecordID takes a Codec and an encoded record and returns the value
+// of the record's id field.
+func RecordID(c Codec, data []byte) (int, error) {
+	var rec struct {
+		ID *int `json:"id"`
+	}
+
+	if err := c.Unmarshal(data, &rec); err != nil {
+		return 0, err
+	}
+
+	if rec.ID == nil {
+		return 0, ErrNoID
+	}
+
+	return *rec.ID, nil
+}
+
+// RecordKey takes a Codec and an encoded record and returns the value
+// of the record's id field, for records whose id is a string key.
+func RecordKey(c Codec, data []byte) (string, error) {
+	var rec struct {
+		ID *string `json:"id"`
+	}
+
+	if err := c.Unmarshal(data, &rec); err != nil {
+		return "", err
+	}
+
+	if rec.ID == nil {
+		return "", ErrNoID
+	}
+
+	return *rec.ID, nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// gobPrefix starts every record encoded by Gob.  The ":" isn't in the
+// base64 alphabet, so a record written before the prefix never has it.
+var gobPrefix = []byte("gob:")
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, len(gobPrefix)+base64.StdEncoding.EncodedLen(buf.Len()))
+	copy(data, gobPrefix)
+	base64.StdEncoding.Encode(data[len(gobPrefix):], buf.Bytes())
+
+	return data, nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	data = bytes.TrimPrefix(data, gobPrefix)
+
+	raw := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+
+	n, err := base64.StdEncoding.Decode(raw, data)
+	if err != nil {
+		return err
+	}
+
+	return gob.NewDecoder(bytes.NewReader(raw[:n])).Decode(v)
+}
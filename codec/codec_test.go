@@ -0,0 +1,138 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+type contact struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"first_name"`
+	Age       int    `json:"age"`
+}
+
+func TestCodecTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//Marshal and Unmarshal...
+
+			for _, c := range []Codec{JSON, Gob} {
+				want := contact{ID: 3, FirstName: "Bill", Age: 18}
+
+				data, err := c.Marshal(&want)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if bytes.ContainsRune(data, '\n') {
+					t.Errorf("want no newline; got %q", data)
+				}
+
+				got := contact{}
+				if err := c.Unmarshal(data, &got); err != nil {
+					t.Fatal(err)
+				}
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(t *testing.T) {
+			//RecordID...
+
+			for _, c := range []Codec{JSON, Gob} {
+				data, err := c.Marshal(&contact{ID: 3, FirstName: "Bill", Age: 18})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := 3
+				got, err := RecordID(c, data)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(t *testing.T) {
+			//RecordID (NoID error)...
+
+			wantErr := ErrNoID
+			_, gotErr := RecordID(JSON, []byte(`{"first_name":"Bill"}`))
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
+		func(t *testing.T) {
+			//RecordKey...
+
+			type keyedContact struct {
+				ID        string `json:"id"`
+				FirstName string `json:"first_name"`
+			}
+
+			for _, c := range []Codec{JSON, Gob} {
+				data, err := c.Marshal(&keyedContact{ID: "bill", FirstName: "Bill"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if _, err := RecordID(c, data); err == nil {
+					t.Errorf("want %v; got %v", "error", err)
+				}
+
+				want := "bill"
+				got, err := RecordKey(c, data)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(t *testing.T) {
+			//Gob (record without prefix)...
+
+			var buf bytes.Buffer
+			if err := gob.NewEncoder(&buf).Encode(&contact{ID: 3, FirstName: "Bill", Age: 18}); err != nil {
+				t.Fatal(err)
+			}
+
+			data := []byte(base64.StdEncoding.EncodeToString(buf.Bytes()))
+
+			want := contact{ID: 3, FirstName: "Bill", Age: 18}
+			got := contact{}
+			if err := Gob.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			data, err := Gob.Marshal(&want)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.HasPrefix(data, gobPrefix) {
+				t.Errorf("want %s; got %s", gobPrefix, data)
+			}
+		},
+	}
+
+	for i, fn := range tests {
+		t.Run(strconv.Itoa(i), fn)
+	}
+}
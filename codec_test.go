@@ -0,0 +1,205 @@
+package hare
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"strconv"
+	"testing"
+
+	"github.com/jameycribbs/hare/codec"
+	"github.com/jameycribbs/hare/datastores/disk"
+	"github.com/jameycribbs/hare/datastores/ram"
+)
+
+func TestCodecTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//WithTableCodec Ram...
+
+			r, err := ram.New(seedData())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db, err := New(r, WithTableCodec("gobs", codec.Gob))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			testCodecRoundTrip(t, db)
+
+			// Other tables keep using the default codec.
+			rawRec, err := db.store.ReadRec("contacts", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rawRec[0] != '{' {
+				t.Errorf("want JSON encoded record; got %s", rawRec)
+			}
+		},
+		func(t *testing.T) {
+			//WithTableCodec Disk (reopened)...
+
+			dir := t.TempDir()
+
+			ds, err := disk.New(dir, ".json", disk.WithTableCodec("gobs", codec.Gob))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db, err := New(ds, WithTableCodec("gobs", codec.Gob))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			testCodecRoundTrip(t, db)
+			db.Close()
+
+			ds, err = disk.New(dir, ".json", disk.WithTableCodec("gobs", codec.Gob))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db, err = New(ds, WithTableCodec("gobs", codec.Gob))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			want := 2
+			got := db.lastIDs["gobs"]
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			c := Contact{}
+			if err := db.Find("gobs", 2, &c); err != nil {
+				t.Fatal(err)
+			}
+
+			wantName := "Abe"
+			gotName := c.FirstName
+			if wantName != gotName {
+				t.Errorf("want %v; got %v", wantName, gotName)
+			}
+		},
+		func(t *testing.T) {
+			//WithTableCodec Disk (gob type descriptor starting with X)...
+
+			// Without a prefix, the base64 of this model's gob encoding
+			// starts with "X", like a dummy record.
+			var buf bytes.Buffer
+			if err := gob.NewEncoder(&buf).Encode(&Person{ID: 1}); err != nil {
+				t.Fatal(err)
+			}
+
+			if b64 := base64.StdEncoding.EncodeToString(buf.Bytes()); b64[0] != 'X' {
+				t.Fatalf("want %v; got %v", "X", b64[:1])
+			}
+
+			dir := t.TempDir()
+
+			ds, err := disk.New(dir, ".json", disk.WithTableCodec("people", codec.Gob))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db, err := New(ds, WithTableCodec("people", codec.Gob))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := db.CreateTable("people"); err != nil {
+				t.Fatal(err)
+			}
+
+			want := Person{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Phone: "555-0100", Age: 36, Notes: "first programmer"}
+
+			id, err := db.Insert("people", &want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			db.Close()
+
+			ds, err = disk.New(dir, ".json", disk.WithTableCodec("people", codec.Gob))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db, err = New(ds, WithTableCodec("people", codec.Gob))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			got := Person{}
+			if err := db.Find("people", id, &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+	}
+
+	for i, fn := range tests {
+		t.Run(strconv.Itoa(i), fn)
+	}
+}
+
+// testCodecRoundTrip creates a table that uses the gob codec and checks
+// records can be inserted and found.
+func testCodecRoundTrip(t *testing.T, db *Database) {
+	if err := db.CreateTable("gobs"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []Contact{{FirstName: "Bill", Age: 18}, {FirstName: "Abe", Age: 52}} {
+		if _, err := db.Insert("gobs", &c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rawRec, err := db.store.ReadRec("gobs", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rawRec[0] == '{' {
+		t.Errorf("want gob encoded record; got %s", rawRec)
+	}
+
+	c := Contact{}
+	if err := db.Find("gobs", 1, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	want := Contact{ID: 1, FirstName: "Bill", Age: 18}
+	if want != c {
+		t.Errorf("want %v; got %v", want, c)
+	}
+}
+
+// Person is a model whose gob type descriptor is long enough that its
+// base64 encoding starts with "X".
+type Person struct {
+	ID        int
+	FirstName string
+	LastName  string
+	Email     string
+	Phone     string
+	Age       int
+	Notes     string
+}
+
+func (p *Person) GetID() int {
+	return p.ID
+}
+
+func (p *Person) SetID(id int) {
+	p.ID = id
+}
@@ -3,47 +3,83 @@
 package hare
 
 import (
-	"encoding/json"
+	"errors"
 	"sync"
 
+	"github.com/jameycribbs/hare/codec"
 	"github.com/jameycribbs/hare/dberr"
 )
 
 // Record interface defines the methods a struct representing
-// a table record must implement.
+// a table record must implement.  A record may also implement any of
+// the optional hook interfaces, such as AfterFinder or BeforeInserter.
 type Record interface {
 	SetID(int)
 	GetID() int
-	AfterFind(*Database) error
 }
 
-type datastorage interface {
-	Close() error
-	CreateTable(string) error
-	DeleteRec(string, int) error
-	GetLastID(string) (int, error)
-	IDs(string) ([]int, error)
-	InsertRec(string, int, []byte) error
-	ReadRec(string, int) ([]byte, error)
-	RemoveTable(string) error
-	TableExists(string) bool
-	TableNames() []string
-	UpdateRec(string, int, []byte) error
+// Database struct is the main struct for the Hare package.  Each table
+// has its own lock, held while the table's records, last id, indexes
+// and unique constraints are used.  The maps holding them are guarded by
+// mu, which is only ever taken after a table's lock, never before it.
+type Database struct {
+	store    Datastore
+	mu       sync.RWMutex
+	locks    map[string]*sync.RWMutex
+	lastIDs  map[string]int
+	indexes  map[string]map[string]*index
+	uniques  map[string][]*unique
+	codec    codec.Codec
+	codecs   map[string]codec.Codec
+	keyFuncs map[string]KeyFunc
+
+	watchMu     sync.Mutex
+	watchers    map[string][]*Watcher
+	watchBuffer int
+
+	closed    bool
+	inflight  sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
 }
 
-// Database struct is the main struct for the Hare package.
-type Database struct {
-	store   datastorage
-	locks   map[string]*sync.RWMutex
-	lastIDs map[string]int
+// Option is a setting that can be passed to New.
+type Option func(*Database)
+
+// WithCodec takes a Codec and returns an Option that makes it the codec
+// records are encoded with, for every table that hasn't been given one
+// with WithTableCodec.  The default is codec.JSON.
+func WithCodec(c codec.Codec) Option {
+	return func(db *Database) {
+		db.codec = c
+	}
 }
 
-// New takes a datastorage and returns a pointer to a
-// Database struct.
-func New(ds datastorage) (*Database, error) {
-	db := &Database{store: ds}
+// WithTableCodec takes a table name and a Codec and returns an Option
+// that makes it the codec that table's records are encoded with.
+func WithTableCodec(tableName string, c codec.Codec) Option {
+	return func(db *Database) {
+		db.codecs[tableName] = c
+	}
+}
+
+// New takes a Datastore and any number of Options and returns a
+// pointer to a Database struct.  A datastore that decodes records
+// itself, like the disk datastore, needs to be given the same codecs.
+func New(ds Datastore, opts ...Option) (*Database, error) {
+	db := &Database{store: ds, codec: codec.JSON, watchBuffer: DefaultWatchBuffer}
+	db.codecs = make(map[string]codec.Codec)
+	db.keyFuncs = make(map[string]KeyFunc)
+	db.watchers = make(map[string][]*Watcher)
+
+	for _, opt := range opts {
+		opt(db)
+	}
+
 	db.locks = make(map[string]*sync.RWMutex)
 	db.lastIDs = make(map[string]int)
+	db.indexes = make(map[string]map[string]*index)
+	db.uniques = make(map[string][]*unique)
 
 	for _, tableName := range db.store.TableNames() {
 		db.locks[tableName] = &sync.RWMutex{}
@@ -58,84 +94,128 @@ func New(ds datastorage) (*Database, error) {
 	return db, nil
 }
 
-// Close closes the associated datastore.
-func (db *Database) Close() error {
-	for _, lock := range db.locks {
-		lock.Lock()
-	}
+// Close waits for the operations already under way to finish and
+// closes the associated datastore.  Once the database is closed, its
+// methods return dberr.ErrClosed, and calling Close again returns what
+// the first call did.
+func (db *Database) Close() (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Close"})
 
-	if err := db.store.Close(); err != nil {
-		return err
-	}
+	db.closeOnce.Do(func() {
+		db.closeErr = db.close()
+	})
 
-	for _, lock := range db.locks {
-		lock.Unlock()
-	}
-
-	db.store = nil
-	db.locks = nil
-	db.lastIDs = nil
-
-	return nil
+	return db.closeErr
 }
 
 // CreateTable takes a table name and creates and
 // initializes a new table.
-func (db *Database) CreateTable(tableName string) error {
-	if db.TableExists(tableName) {
+func (db *Database) CreateTable(tableName string) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "CreateTable", Table: tableName})
+
+	if err := db.enter(); err != nil {
+		return err
+	}
+	defer db.exit()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.locks[tableName]; ok && db.store.TableExists(tableName) {
 		return dberr.ErrTableExists
 	}
 
 	if err := db.store.CreateTable(tableName); err != nil {
-		return nil
+		return err
 	}
 
-	db.locks[tableName] = &sync.RWMutex{}
-
 	lastID, err := db.store.GetLastID(tableName)
 	if err != nil {
 		return err
 	}
+
+	db.locks[tableName] = &sync.RWMutex{}
 	db.lastIDs[tableName] = lastID
 
 	return nil
 }
 
 // Delete takes a table name and record id and removes that
-// record from the database.
-func (db *Database) Delete(tableName string, id int) error {
-	if !db.TableExists(tableName) {
-		return dberr.ErrNoTable
+// record from the database.  As it is not given a record, it can't run
+// delete hooks; use DeleteRecord or Table.Delete for models that have
+// them.
+func (db *Database) Delete(tableName string, id int) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Delete", Table: tableName, ID: id})
+
+	if err := db.enter(); err != nil {
+		return err
 	}
+	defer db.exit()
 
-	db.locks[tableName].Lock()
-	defer db.locks[tableName].Unlock()
+	if err := db.checkIDTable(tableName); err != nil {
+		return err
+	}
 
-	if err := db.store.DeleteRec(tableName, id); err != nil {
+	return db.deleteLocked(tableName, id)
+}
+
+// DeleteRecord takes a table name and a struct that implements the
+// Record interface and removes the record in the table that has that
+// record's id.  If the record implements BeforeDeleter, an error from
+// BeforeDelete aborts the delete.  If it implements AfterDeleter,
+// AfterDelete is called once the record has been deleted.
+func (db *Database) DeleteRecord(tableName string, rec Record) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "DeleteRecord", Table: tableName, ID: rec.GetID()})
+
+	if err := db.enter(); err != nil {
 		return err
 	}
+	defer db.exit()
 
-	return nil
+	if err := db.checkIDTable(tableName); err != nil {
+		return err
+	}
+
+	if err := db.beforeDelete(rec); err != nil {
+		return err
+	}
+
+	if err := db.deleteLocked(tableName, rec.GetID()); err != nil {
+		return err
+	}
+
+	return db.afterDelete(rec)
 }
 
-// DropTable takes a table name and deletes the table.
-func (db *Database) DropTable(tableName string) error {
-	if !db.TableExists(tableName) {
-		return dberr.ErrNoTable
+// DropTable takes a table name and deletes the table.  Operations on
+// the table that are waiting for its lock return dberr.ErrNoTable once
+// it has been dropped.
+func (db *Database) DropTable(tableName string) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "DropTable", Table: tableName})
+
+	if err := db.enter(); err != nil {
+		return err
 	}
+	defer db.exit()
 
-	db.locks[tableName].Lock()
+	lock, err := db.lockTable(tableName)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
 
 	if err := db.store.RemoveTable(tableName); err != nil {
-		db.locks[tableName].Unlock()
 		return err
 	}
 
+	db.mu.Lock()
+	delete(db.locks, tableName)
 	delete(db.lastIDs, tableName)
+	delete(db.indexes, tableName)
+	delete(db.uniques, tableName)
+	db.mu.Unlock()
 
-	db.locks[tableName].Unlock()
-
-	delete(db.locks, tableName)
+	db.emit(EventDrop, tableName, 0, nil)
 
 	return nil
 }
@@ -143,41 +223,46 @@ func (db *Database) DropTable(tableName string) error {
 // Find takes a table name, a record id, and a pointer to a struct that
 // implements the Record interface, finds the associated record from the
 // table, and populates the struct.
-func (db *Database) Find(tableName string, id int, rec Record) error {
-	if !db.TableExists(tableName) {
-		return dberr.ErrNoTable
-	}
-
-	db.locks[tableName].RLock()
-	defer db.locks[tableName].RUnlock()
+func (db *Database) Find(tableName string, id int, rec Record) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Find", Table: tableName, ID: id})
 
-	rawRec, err := db.store.ReadRec(tableName, id)
-	if err != nil {
+	if err := db.enter(); err != nil {
 		return err
 	}
+	defer db.exit()
 
-	err = json.Unmarshal(rawRec, rec)
-	if err != nil {
+	if err := db.checkIDTable(tableName); err != nil {
 		return err
 	}
 
-	err = rec.AfterFind(db)
-	if err != nil {
+	if err := db.readRec(tableName, id, rec); err != nil {
 		return err
 	}
 
-	return nil
+	// The hook runs once the table's lock is released, so it can read
+	// other tables without deadlocking a Commit that has locked them.
+	return db.afterFind(rec)
 }
 
 // IDs takes a table name and returns a list of all record ids for
 // that table.
-func (db *Database) IDs(tableName string) ([]int, error) {
-	if !db.TableExists(tableName) {
-		return nil, dberr.ErrNoTable
+func (db *Database) IDs(tableName string) (_ []int, err error) {
+	defer wrapErr(&err, dberr.Error{Op: "IDs", Table: tableName})
+
+	if err := db.enter(); err != nil {
+		return nil, err
 	}
+	defer db.exit()
 
-	db.locks[tableName].Lock()
-	defer db.locks[tableName].Unlock()
+	if err := db.checkIDTable(tableName); err != nil {
+		return nil, err
+	}
+
+	lock, err := db.lockTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
 
 	ids, err := db.store.IDs(tableName)
 	if err != nil {
@@ -189,50 +274,174 @@ func (db *Database) IDs(tableName string) ([]int, error) {
 
 // Insert takes a table name and a struct that implements the Record
 // interface and adds a new record to the table.  It returns the
-// new record's id.
-func (db *Database) Insert(tableName string, rec Record) (int, error) {
-	if !db.TableExists(tableName) {
-		return 0, dberr.ErrNoTable
+// new record's id.  If the record implements BeforeInserter, an error
+// from BeforeInsert aborts the insert.  If it implements AfterInserter,
+// an error from AfterInsert is returned along with the id of the record,
+// which has already been inserted.
+func (db *Database) Insert(tableName string, rec Record) (_ int, err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Insert", Table: tableName})
+
+	if err := db.enter(); err != nil {
+		return 0, err
 	}
+	defer db.exit()
 
-	db.locks[tableName].Lock()
-	defer db.locks[tableName].Unlock()
-
-	id := db.incrementLastID(tableName)
-	rec.SetID(id)
+	if err := db.checkIDTable(tableName); err != nil {
+		return 0, err
+	}
 
-	rawRec, err := json.Marshal(rec)
-	if err != nil {
+	if err := db.beforeInsert(rec); err != nil {
 		return 0, err
 	}
 
-	if err := db.store.InsertRec(tableName, id, rawRec); err != nil {
+	id, err := db.insertLocked(tableName, rec)
+	if err != nil {
 		return 0, err
 	}
 
-	return id, nil
+	return id, db.afterInsert(rec)
 }
 
 // TableExists takes a table name and returns true if the table exists,
 // false if it does not.
 func (db *Database) TableExists(tableName string) bool {
-	return db.tableExists(tableName) && db.store.TableExists(tableName)
+	if err := db.enter(); err != nil {
+		return false
+	}
+	defer db.exit()
+
+	return db.hasTable(tableName)
 }
 
 // Update takes a table name and a struct that implements the Record
 // interface and updates the record in the table that has that record's
-// id.
-func (db *Database) Update(tableName string, rec Record) error {
-	if !db.TableExists(tableName) {
-		return dberr.ErrNoTable
+// id.  If the record implements BeforeUpdater, an error from
+// BeforeUpdate aborts the update.  If it implements AfterUpdater,
+// AfterUpdate is called once the record has been updated.
+func (db *Database) Update(tableName string, rec Record) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Update", Table: tableName, ID: rec.GetID()})
+
+	if err := db.enter(); err != nil {
+		return err
 	}
+	defer db.exit()
 
-	db.locks[tableName].Lock()
-	defer db.locks[tableName].Unlock()
+	if err := db.checkIDTable(tableName); err != nil {
+		return err
+	}
 
-	id := rec.GetID()
+	if err := db.beforeUpdate(rec); err != nil {
+		return err
+	}
 
-	rawRec, err := json.Marshal(rec)
+	if err := db.updateLocked(tableName, rec); err != nil {
+		return err
+	}
+
+	return db.afterUpdate(rec)
+}
+
+// unexported methods
+
+// close stops new operations from starting, waits for those under way
+// and closes the datastore.
+func (db *Database) close() error {
+	db.mu.Lock()
+	db.closed = true
+	db.mu.Unlock()
+
+	db.inflight.Wait()
+
+	err := db.store.Close()
+
+	db.closeWatchers()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.store = nil
+	db.locks = nil
+	db.lastIDs = nil
+	db.indexes = nil
+	db.uniques = nil
+
+	return err
+}
+
+// enter registers an operation that is starting, so Close waits for
+// it.  It returns dberr.ErrClosed if the database has been closed.
+// Every exported method calls it, and exit once it is done.
+func (db *Database) enter() error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return dberr.ErrClosed
+	}
+
+	db.inflight.Add(1)
+
+	return nil
+}
+
+// exit registers that an operation started with enter is done.
+func (db *Database) exit() {
+	db.inflight.Done()
+}
+
+// deleteRec removes a record from the datastore and the table's
+// indexes.  The caller must hold the table's write lock.
+func (db *Database) deleteRec(tableName string, id int) error {
+	oldFields, err := db.indexedFields(tableName, id)
+	if err != nil {
+		return err
+	}
+
+	if err := db.store.DeleteRec(tableName, id); err != nil {
+		return err
+	}
+
+	db.updateIndexes(tableName, id, oldFields, nil)
+
+	return nil
+}
+
+// insertRec checks a raw record against the table's unique constraints
+// and adds it to the datastore and the table's indexes.  The caller must
+// hold the table's write lock.
+func (db *Database) insertRec(tableName string, id int, rawRec []byte) error {
+	newFields, err := db.decodeIndexed(tableName, rawRec)
+	if err != nil {
+		return err
+	}
+
+	if err := db.checkUniques(tableName, id, newFields); err != nil {
+		return err
+	}
+
+	if err := db.store.InsertRec(tableName, id, rawRec); err != nil {
+		return err
+	}
+
+	db.updateIndexes(tableName, id, nil, newFields)
+
+	return nil
+}
+
+// updateRec checks a raw record against the table's unique constraints
+// and replaces it in the datastore and the table's indexes.  The caller
+// must hold the table's write lock.
+func (db *Database) updateRec(tableName string, id int, rawRec []byte) error {
+	newFields, err := db.decodeIndexed(tableName, rawRec)
+	if err != nil {
+		return err
+	}
+
+	if err := db.checkUniques(tableName, id, newFields); err != nil {
+		return err
+	}
+
+	oldFields, err := db.indexedFields(tableName, id)
 	if err != nil {
 		return err
 	}
@@ -241,22 +450,242 @@ func (db *Database) Update(tableName string, rec Record) error {
 		return err
 	}
 
+	db.updateIndexes(tableName, id, oldFields, newFields)
+
 	return nil
 }
 
-// unexported methods
+// deleteLocked removes a record, holding the table's write lock.
+func (db *Database) deleteLocked(tableName string, id int) error {
+	lock, err := db.lockTable(tableName)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if err := db.deleteRec(tableName, id); err != nil {
+		return err
+	}
+
+	db.emit(EventDelete, tableName, id, nil)
+
+	return nil
+}
+
+// insertLocked assigns a record the next id and inserts it, holding the
+// table's write lock.
+func (db *Database) insertLocked(tableName string, rec Record) (int, error) {
+	lock, err := db.lockTable(tableName)
+	if err != nil {
+		return 0, err
+	}
+	defer lock.Unlock()
+
+	id, err := db.incrementLastID(tableName)
+	if err != nil {
+		return 0, err
+	}
+	rec.SetID(id)
+
+	rawRec, err := db.marshalRec(tableName, rec)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := db.insertRec(tableName, id, rawRec); err != nil {
+		return 0, err
+	}
+
+	db.emit(EventInsert, tableName, id, rawRec)
+
+	return id, nil
+}
+
+// updateLocked updates a record, holding the table's write lock.
+func (db *Database) updateLocked(tableName string, rec Record) error {
+	lock, err := db.lockTable(tableName)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	rawRec, err := db.marshalRec(tableName, rec)
+	if err != nil {
+		return err
+	}
+
+	if err := db.updateRec(tableName, rec.GetID(), rawRec); err != nil {
+		return err
+	}
+
+	db.emit(EventUpdate, tableName, rec.GetID(), rawRec)
+
+	return nil
+}
+
+// incrementLastID returns the next id for a table, from the datastore's
+// Sequencer if it has one.  The caller must hold the table's write lock.
+func (db *Database) incrementLastID(tableName string) (int, error) {
+	if sequencer, ok := db.store.(Sequencer); ok {
+		lastID, err := sequencer.NextID(tableName)
+		if err != nil {
+			return 0, err
+		}
+
+		db.mu.Lock()
+		db.lastIDs[tableName] = lastID
+		db.mu.Unlock()
+
+		return lastID, nil
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
 
-func (db *Database) incrementLastID(tableName string) int {
 	lastID := db.lastIDs[tableName]
 
 	lastID++
 
 	db.lastIDs[tableName] = lastID
 
-	return lastID
+	return lastID, nil
+}
+
+// codecFor returns the codec a table's records are encoded with.
+func (db *Database) codecFor(tableName string) codec.Codec {
+	if c, ok := db.codecs[tableName]; ok {
+		return c
+	}
+
+	return db.codec
+}
+
+// decodeFields takes a table name and a raw record and returns the
+// record's decoded fields.  Numbers are always returned as float64, the
+// way encoding/json decodes them, whatever the codec.
+func (db *Database) decodeFields(tableName string, rawRec []byte) (map[string]interface{}, error) {
+	var fields map[string]interface{}
+
+	if err := db.codecFor(tableName).Unmarshal(rawRec, &fields); err != nil {
+		return nil, err
+	}
+
+	for k, v := range fields {
+		fields[k] = normalizeValue(v)
+	}
+
+	return fields, nil
+}
+
+func (db *Database) marshalRec(tableName string, rec Record) ([]byte, error) {
+	return db.codecFor(tableName).Marshal(rec)
+}
+
+// readRec populates rec from a table's record, under the table's read
+// lock.  It doesn't run rec's AfterFind hook.
+func (db *Database) readRec(tableName string, id int, rec Record) error {
+	lock, err := db.rlockTable(tableName)
+	if err != nil {
+		return err
+	}
+	defer lock.RUnlock()
+
+	rawRec, err := db.store.ReadRec(tableName, id)
+	if err != nil {
+		return err
+	}
+
+	return db.codecFor(tableName).Unmarshal(rawRec, rec)
+}
+
+// unmarshalRec populates rec from a raw record and runs its AfterFind
+// hook, if it has one.  The caller mustn't hold a table's lock.
+func (db *Database) unmarshalRec(tableName string, rawRec []byte, rec Record) error {
+	if err := db.codecFor(tableName).Unmarshal(rawRec, rec); err != nil {
+		return err
+	}
+
+	return db.afterFind(rec)
+}
+
+// lockTable write locks a table and returns its lock.  It returns
+// dberr.ErrNoTable if the table doesn't exist, or was dropped while
+// waiting for the lock.
+func (db *Database) lockTable(tableName string) (*sync.RWMutex, error) {
+	lock := db.tableLock(tableName)
+	if lock == nil {
+		return nil, dberr.ErrNoTable
+	}
+
+	lock.Lock()
+
+	if !db.holdsTable(tableName, lock) {
+		lock.Unlock()
+		return nil, dberr.ErrNoTable
+	}
+
+	return lock, nil
+}
+
+// rlockTable is lockTable for a read lock.
+func (db *Database) rlockTable(tableName string) (*sync.RWMutex, error) {
+	lock := db.tableLock(tableName)
+	if lock == nil {
+		return nil, dberr.ErrNoTable
+	}
+
+	lock.RLock()
+
+	if !db.holdsTable(tableName, lock) {
+		lock.RUnlock()
+		return nil, dberr.ErrNoTable
+	}
+
+	return lock, nil
+}
+
+// holdsTable reports whether lock is still the lock of an existing
+// table, rather than that of a table that has since been dropped and
+// possibly created again.
+func (db *Database) holdsTable(tableName string, lock *sync.RWMutex) bool {
+	return db.tableLock(tableName) == lock && db.store.TableExists(tableName)
+}
+
+// tableLock returns a table's lock, or nil if there is no such table.
+func (db *Database) tableLock(tableName string) *sync.RWMutex {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.locks[tableName]
+}
+
+// tableIndexes returns a table's indexes.  The caller must hold the
+// table's lock.
+func (db *Database) tableIndexes(tableName string) map[string]*index {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.indexes[tableName]
+}
+
+// tableUniques returns a table's unique constraints.  The caller must
+// hold the table's lock.
+func (db *Database) tableUniques(tableName string) []*unique {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.uniques[tableName]
+}
+
+// hasTable is TableExists for operations that are already under way.
+func (db *Database) hasTable(tableName string) bool {
+	return db.tableExists(tableName) && db.store.TableExists(tableName)
 }
 
 func (db *Database) tableExists(tableName string) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
 	_, ok := db.locks[tableName]
 	if !ok {
 		return false
@@ -268,3 +697,20 @@ func (db *Database) tableExists(tableName string) bool {
 
 	return ok
 }
+
+// wrapErr gives the error errp points to, if there is one, the context
+// in e, unless it already has the context of another operation, as it
+// does when one method is called from another.
+func wrapErr(errp *error, e dberr.Error) {
+	if *errp == nil {
+		return
+	}
+
+	var dbErr *dberr.Error
+	if errors.As(*errp, &dbErr) {
+		return
+	}
+
+	e.Err = *errp
+	*errp = &e
+}
@@ -1,10 +1,13 @@
 package hare
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/jameycribbs/hare/datastores/disk"
 	"github.com/jameycribbs/hare/datastores/ram"
@@ -27,7 +30,7 @@ func TestCloseDatabaseTests(t *testing.T) {
 			}
 			db.Close()
 
-			checkErr(t, dberr.ErrNoTable, db.Find("contacts", 3, &Contact{}))
+			checkErr(t, dberr.ErrClosed, db.Find("contacts", 3, &Contact{}))
 
 			gotStore := db.store
 			if nil != gotStore {
@@ -58,7 +61,7 @@ func TestCloseDatabaseTests(t *testing.T) {
 			}
 			db.Close()
 
-			checkErr(t, dberr.ErrNoTable, db.Find("contacts", 3, &Contact{}))
+			checkErr(t, dberr.ErrClosed, db.Find("contacts", 3, &Contact{}))
 
 			gotStore := db.store
 			if nil != gotStore {
@@ -75,6 +78,89 @@ func TestCloseDatabaseTests(t *testing.T) {
 				t.Errorf("want %v; got %v", nil, gotLastIDs)
 			}
 		},
+		func(t *testing.T) {
+			//Close (twice)...
+
+			r, err := ram.New(seedData())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db, err := New(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := db.Close(); err != nil {
+				t.Errorf("want %v; got %v", nil, err)
+			}
+
+			_, err = db.Insert("contacts", &Contact{FirstName: "Robin", LastName: "Williams", Age: 88})
+			checkErr(t, dberr.ErrClosed, err)
+
+			_, err = db.Query("contacts").IDs()
+			checkErr(t, dberr.ErrClosed, err)
+
+			checkErr(t, dberr.ErrClosed, db.Begin().Commit())
+
+			want := false
+			got := db.TableExists("contacts")
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//Close (waits for operations under way)...
+
+			r, err := ram.New(seedData())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db, err := New(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c := &blockingContact{
+				Contact: Contact{FirstName: "Robin", LastName: "Williams", Age: 88},
+				started: make(chan struct{}),
+				release: make(chan struct{}),
+			}
+
+			inserted := make(chan error, 1)
+			go func() {
+				_, err := db.Insert("contacts", c)
+				inserted <- err
+			}()
+
+			<-c.started
+
+			closed := make(chan error, 1)
+			go func() {
+				closed <- db.Close()
+			}()
+
+			select {
+			case <-closed:
+				t.Fatal("want Close to wait for Insert; it didn't")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			close(c.release)
+
+			if err := <-inserted; err != nil {
+				t.Errorf("want %v; got %v", nil, err)
+			}
+
+			if err := <-closed; err != nil {
+				t.Errorf("want %v; got %v", nil, err)
+			}
+		},
 	}
 
 	for i, fn := range tests {
@@ -82,6 +168,82 @@ func TestCloseDatabaseTests(t *testing.T) {
 	}
 }
 
+func TestErrorTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//Error...
+
+			r, err := ram.New(seedData())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db, err := New(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			gotErr := db.Find("contacts", 99, &Contact{})
+
+			checkErr(t, dberr.ErrNoRecord, gotErr)
+
+			var dbErr *dberr.Error
+			if !errors.As(gotErr, &dbErr) {
+				t.Fatalf("want %T; got %T", dbErr, gotErr)
+			}
+
+			want := dberr.Error{Op: "Find", Table: "contacts", ID: 99, Err: dberr.ErrNoRecord}
+			if want != *dbErr {
+				t.Errorf("want %v; got %v", want, *dbErr)
+			}
+
+			wantMsg := "Find contacts record 99: hare: no record with that id found"
+			if wantMsg != gotErr.Error() {
+				t.Errorf("want %v; got %v", wantMsg, gotErr.Error())
+			}
+		},
+		func(t *testing.T) {
+			//CreateTable (datastore error)...
+
+			testSetup(t)
+			defer testTeardown(t)
+
+			ds, err := disk.New("./testdata", ".json", disk.WithLock(disk.LockShared))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db, err := New(ds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			checkErr(t, dberr.ErrReadOnly, db.CreateTable("newtable"))
+		},
+	}
+
+	for i, fn := range tests {
+		t.Run(strconv.Itoa(i), fn)
+	}
+}
+
+// blockingContact is a Contact whose BeforeInsert hook waits to be
+// released, holding its Insert open.
+type blockingContact struct {
+	Contact
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingContact) BeforeInsert(db *Database) error {
+	close(c.started)
+	<-c.release
+
+	return nil
+}
+
 func TestNonMutatingDatabaseTests(t *testing.T) {
 	var tests = []func(*Database) func(*testing.T){
 		func(db *Database) func(*testing.T) {
@@ -184,12 +346,83 @@ func TestMutatingDatabaseTests(t *testing.T) {
 				checkErr(t, dberr.ErrNoTable, db.DropTable("nonexistent"))
 			}
 		},
+		func(db *Database) func(*testing.T) {
+			//CreateTable/DropTable (concurrent with Find and Insert)...
+
+			return func(t *testing.T) {
+				var wg sync.WaitGroup
+				errs := make(chan error, 9)
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					for i := 0; i < 50; i++ {
+						if err := db.CreateTable("newtable"); err != nil {
+							errs <- err
+							return
+						}
+
+						if err := db.DropTable("newtable"); err != nil {
+							errs <- err
+							return
+						}
+					}
+				}()
+
+				for g := 0; g < 8; g++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+
+						for i := 0; i < 100; i++ {
+							id, err := db.Insert("newtable", &Contact{FirstName: "Robin", LastName: "Williams", Age: 88})
+							if err != nil && !errors.Is(err, dberr.ErrNoTable) {
+								errs <- err
+								return
+							}
+
+							c := Contact{}
+							err = db.Find("newtable", id, &c)
+							if err != nil && !errors.Is(err, dberr.ErrNoTable) && !errors.Is(err, dberr.ErrNoRecord) {
+								errs <- err
+								return
+							}
+
+							if err := db.Find("contacts", 1, &c); err != nil {
+								errs <- err
+								return
+							}
+
+							db.TableExists("newtable")
+						}
+					}()
+				}
+
+				wg.Wait()
+				close(errs)
+
+				for err := range errs {
+					t.Error(err)
+				}
+
+				want := false
+				got := db.TableExists("newtable")
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
 		func(db *Database) func(*testing.T) {
 			//incrementLastID...
 
 			return func(t *testing.T) {
 				want := 5
-				got := db.incrementLastID("contacts")
+				got, err := db.incrementLastID("contacts")
+				if err != nil {
+					t.Fatal(err)
+				}
 
 				if want != got {
 					t.Errorf("want %v; got %v", want, got)
@@ -295,6 +528,45 @@ func TestRecordTests(t *testing.T) {
 				checkErr(t, dberr.ErrNoRecord, db.Find("contacts", 99, &Contact{}))
 			}
 		},
+		func(db *Database) func(*testing.T) {
+			//Find (concurrent readers)...
+
+			return func(t *testing.T) {
+				want := map[int]string{1: "John", 2: "Abe", 3: "Bill", 4: "Helen"}
+
+				var wg sync.WaitGroup
+				errs := make(chan error, 32)
+
+				for g := 0; g < 32; g++ {
+					wg.Add(1)
+					go func(g int) {
+						defer wg.Done()
+
+						for i := 0; i < 200; i++ {
+							id := (g+i)%4 + 1
+
+							c := Contact{}
+							if err := db.Find("contacts", id, &c); err != nil {
+								errs <- err
+								return
+							}
+
+							if c.ID != id || c.FirstName != want[id] {
+								errs <- fmt.Errorf("want %v %v; got %v %v", id, want[id], c.ID, c.FirstName)
+								return
+							}
+						}
+					}(g)
+				}
+
+				wg.Wait()
+				close(errs)
+
+				for err := range errs {
+					t.Error(err)
+				}
+			}
+		},
 		func(db *Database) func(*testing.T) {
 			//Insert...
 
@@ -0,0 +1,264 @@
+package hare
+
+import (
+	"bytes"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// DatastoreVersion is the version of the Datastore interface.  Methods
+// are never added to a published version of Datastore; new features a
+// datastore may support are described by separate, optional interfaces,
+// such as Batcher, Compactor, CompactReporter, KeyedStore, Scanner,
+// Sequencer and Snapshotter, that Database looks for with type
+// assertions.
+const DatastoreVersion = 1
+
+// Datastore is the interface a back-end must implement to hold the
+// tables of a Database.  The datastores/disk and datastores/ram
+// packages provide the two built-in implementations.
+//
+// Database holds a read/write lock for each table, so a table is never
+// written to while another goroutine is using it, but it may be read by
+// several goroutines at once, and different tables may be used at the
+// same time.  The datastores/conformance package has tests that check
+// a Datastore behaves the way Database expects.
+//
+// Methods that take a table name return dberr.ErrNoTable if there is no
+// such table.  Methods that take a record id return dberr.ErrNoRecord
+// if there is no such record, except for InsertRec, which returns
+// dberr.ErrIDExists if there already is one.  ReadRec returns the bytes
+// passed to InsertRec or UpdateRec, optionally followed by a newline.
+type Datastore interface {
+	// Close closes the datastore.
+	Close() error
+	// CreateTable takes a table name and creates an empty table.  It
+	// returns dberr.ErrTableExists if the table already exists.
+	CreateTable(tableName string) error
+	// DeleteRec takes a table name and a record id and deletes the
+	// record.
+	DeleteRec(tableName string, id int) error
+	// GetLastID takes a table name and returns the greatest record id
+	// in the table, or 0 if it is empty.
+	GetLastID(tableName string) (int, error)
+	// IDs takes a table name and returns the ids of all of the
+	// records in the table, in no particular order.
+	IDs(tableName string) ([]int, error)
+	// InsertRec takes a table name, a record id and a raw record and
+	// adds the record to the table.
+	InsertRec(tableName string, id int, rec []byte) error
+	// ReadRec takes a table name and a record id and returns the raw
+	// record.
+	ReadRec(tableName string, id int) ([]byte, error)
+	// RemoveTable takes a table name and deletes the table and all of
+	// its records.
+	RemoveTable(tableName string) error
+	// TableExists takes a table name and reports whether the table
+	// exists.
+	TableExists(tableName string) bool
+	// TableNames returns the names of all of the tables.
+	TableNames() []string
+	// UpdateRec takes a table name, a record id and a raw record and
+	// replaces the record with that id.
+	UpdateRec(tableName string, id int, rec []byte) error
+}
+
+// Batcher is implemented by datastores that can make changes to several
+// tables as one, so that a crash part way through can't leave only some
+// of them made.  Transactions need one.
+type Batcher interface {
+	// Batch takes the names of some tables and a function that
+	// changes them, and calls the function.  If the process dies, or
+	// the machine loses power, before Batch returns, either every
+	// change the function made is kept or none is.  Batch doesn't
+	// undo the changes if the function returns an error; it returns
+	// the error.
+	Batch(tableNames []string, fn func() error) error
+}
+
+// Compactor is implemented by datastores that can reclaim the space
+// left behind by deleted and updated records.
+type Compactor interface {
+	// CompactTable takes a table name and compacts the table.
+	CompactTable(tableName string) error
+}
+
+// CompactReporter is implemented by datastores that can say how much
+// space compacting a table reclaimed.
+type CompactReporter interface {
+	// CompactTableReport takes a table name, compacts the table and
+	// returns the number of bytes reclaimed.
+	CompactTableReport(tableName string) (int64, error)
+}
+
+// Scanner is implemented by datastores that can read every record in a
+// table in a single pass, which is faster than calling ReadRec for
+// each id.
+type Scanner interface {
+	// Scan takes a table name and calls fn with the id and the raw
+	// record of every record in the table, in no particular order.
+	// It stops and returns the error if fn returns one.
+	Scan(tableName string, fn func(id int, rec []byte) error) error
+}
+
+// Snapshotter is implemented by datastores that can make a
+// point-in-time copy of a table.
+type Snapshotter interface {
+	// Snapshot takes a table name and returns a copy of every record
+	// in the table, keyed by record id.
+	Snapshot(tableName string) (map[int][]byte, error)
+}
+
+// Sequencer is implemented by datastores that keep a persistent id
+// sequence for each table, so that the id of a deleted record is never
+// handed out again, even after the datastore is reopened.  Without one,
+// Database assigns ids from the greatest id in each table when it is
+// opened.
+type Sequencer interface {
+	// NextID takes a table name, advances the table's sequence and
+	// returns its new value, which is greater than any id the
+	// sequence has returned before and any id in the table.
+	NextID(tableName string) (int, error)
+}
+
+// KeyedStore is implemented by datastores that can hold records
+// identified by string keys, for tables set up with WithKeys.  Its
+// methods behave like the Datastore methods with the same names, with a
+// key in place of the record id.
+type KeyedStore interface {
+	// DeleteKeyedRec takes a table name and a record key and deletes
+	// the record.
+	DeleteKeyedRec(tableName string, key string) error
+	// InsertKeyedRec takes a table name, a record key and a raw record
+	// and adds the record to the table.
+	InsertKeyedRec(tableName string, key string, rec []byte) error
+	// Keys takes a table name and returns the keys of all of the
+	// records in the table, in no particular order.
+	Keys(tableName string) ([]string, error)
+	// ReadKeyedRec takes a table name and a record key and returns
+	// the raw record.
+	ReadKeyedRec(tableName string, key string) ([]byte, error)
+	// UpdateKeyedRec takes a table name, a record key and a raw record
+	// and replaces the record with that key.
+	UpdateKeyedRec(tableName string, key string, rec []byte) error
+}
+
+// Compact takes a table name and, if the datastore implements
+// Compactor, compacts the table while holding its write lock.  It
+// returns dberr.ErrNotSupported if the datastore can't compact.
+func (db *Database) Compact(tableName string) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Compact", Table: tableName})
+
+	if err := db.enter(); err != nil {
+		return err
+	}
+	defer db.exit()
+
+	if !db.hasTable(tableName) {
+		return dberr.ErrNoTable
+	}
+
+	compactor, ok := db.store.(Compactor)
+	if !ok {
+		return dberr.ErrNotSupported
+	}
+
+	lock, err := db.lockTable(tableName)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	return compactor.CompactTable(tableName)
+}
+
+// CompactReport takes a table name and, if the datastore implements
+// CompactReporter, compacts the table while holding its write lock and
+// returns the number of bytes reclaimed.  It returns
+// dberr.ErrNotSupported if the datastore can't report them.
+func (db *Database) CompactReport(tableName string) (_ int64, err error) {
+	defer wrapErr(&err, dberr.Error{Op: "CompactReport", Table: tableName})
+
+	if err := db.enter(); err != nil {
+		return 0, err
+	}
+	defer db.exit()
+
+	if !db.hasTable(tableName) {
+		return 0, dberr.ErrNoTable
+	}
+
+	reporter, ok := db.store.(CompactReporter)
+	if !ok {
+		return 0, dberr.ErrNotSupported
+	}
+
+	lock, err := db.lockTable(tableName)
+	if err != nil {
+		return 0, err
+	}
+	defer lock.Unlock()
+
+	return reporter.CompactTableReport(tableName)
+}
+
+// Snapshot takes a table name and returns a consistent copy of every
+// raw record in the table, keyed by record id.  It uses the datastore's
+// Snapshotter if it has one.
+func (db *Database) Snapshot(tableName string) (_ map[int][]byte, err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Snapshot", Table: tableName})
+
+	if err := db.enter(); err != nil {
+		return nil, err
+	}
+	defer db.exit()
+
+	lock, err := db.rlockTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.RUnlock()
+
+	if snapshotter, ok := db.store.(Snapshotter); ok {
+		return snapshotter.Snapshot(tableName)
+	}
+
+	recs := make(map[int][]byte)
+
+	err = db.scanTable(tableName, func(id int, rawRec []byte) error {
+		recs[id] = rawRec
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recs, nil
+}
+
+// scanTable calls fn with every record in a table, using the
+// datastore's Scanner if it has one.  The caller must hold the table's
+// lock.
+func (db *Database) scanTable(tableName string, fn func(id int, rawRec []byte) error) error {
+	if scanner, ok := db.store.(Scanner); ok {
+		return scanner.Scan(tableName, fn)
+	}
+
+	ids, err := db.store.IDs(tableName)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		rawRec, err := db.store.ReadRec(tableName, id)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(id, bytes.TrimSuffix(rawRec, []byte("\n"))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
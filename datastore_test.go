@@ -0,0 +1,193 @@
+package hare
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/jameycribbs/hare/datastores/disk"
+	"github.com/jameycribbs/hare/datastores/ram"
+	"github.com/jameycribbs/hare/dberr"
+)
+
+var (
+	_ Datastore       = (*disk.Disk)(nil)
+	_ Compactor       = (*disk.Disk)(nil)
+	_ CompactReporter = (*disk.Disk)(nil)
+	_ Scanner         = (*disk.Disk)(nil)
+	_ Sequencer       = (*disk.Disk)(nil)
+	_ Snapshotter     = (*disk.Disk)(nil)
+
+	_ Datastore   = (*ram.Ram)(nil)
+	_ Scanner     = (*ram.Ram)(nil)
+	_ Sequencer   = (*ram.Ram)(nil)
+	_ Snapshotter = (*ram.Ram)(nil)
+)
+
+func TestDatastoreTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//Compact...
+
+			return func(t *testing.T) {
+				err := db.Compact("contacts")
+
+				if _, ok := db.store.(Compactor); !ok {
+					checkErr(t, dberr.ErrNotSupported, err)
+					return
+				}
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				c := Contact{}
+				if err := db.Find("contacts", 3, &c); err != nil {
+					t.Fatal(err)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Compact (NoTable error)...
+
+			return func(t *testing.T) {
+				checkErr(t, dberr.ErrNoTable, db.Compact("nonexistent"))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//CompactReport...
+
+			return func(t *testing.T) {
+				got, err := db.CompactReport("contacts")
+
+				if _, ok := db.store.(CompactReporter); !ok {
+					checkErr(t, dberr.ErrNotSupported, err)
+					return
+				}
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// The seed data has one dummy line of 44 Xs.
+				want := int64(45)
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				got, err = db.CompactReport("contacts")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want = 0
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Snapshot...
+
+			return func(t *testing.T) {
+				got, err := db.Snapshot("contacts")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := make(map[int][]byte)
+				for id, rec := range seedData()["contacts"] {
+					want[id] = []byte(rec)
+				}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//scanTable...
+
+			return func(t *testing.T) {
+				got := make(map[int]string)
+
+				err := db.scanTable("contacts", func(id int, rawRec []byte) error {
+					got[id] = string(rawRec)
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := seedData()["contacts"]
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
+func TestSequenceTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//Insert after deleting the newest record and reopening...
+
+			testSetup(t)
+			defer testTeardown(t)
+
+			ds, err := disk.New("./testdata", ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db, err := New(ds)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := db.Delete("contacts", 4); err != nil {
+				t.Fatal(err)
+			}
+
+			id, err := db.Insert("contacts", &Contact{FirstName: "Rex", LastName: "Stout", Age: 77})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := db.Delete("contacts", id); err != nil {
+				t.Fatal(err)
+			}
+
+			db.Close()
+
+			ds, err = disk.New("./testdata", ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db, err = New(ds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			want := 6
+			got, err := db.Insert("contacts", &Contact{FirstName: "Nero", LastName: "Wolfe", Age: 56})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+	}
+
+	for i, fn := range tests {
+		t.Run(strconv.Itoa(i), fn)
+	}
+}
@@ -0,0 +1,719 @@
+// Package conformance implements tests that check a hare.Datastore
+// behaves the way hare.Database expects it to.  A datastore package
+// runs them from one of its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, func(t *testing.T) hare.Datastore {
+//			return newEmptyStore(t)
+//		})
+//	}
+package conformance
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/jameycribbs/hare"
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// Factory takes the running test and returns a new, empty datastore.
+// Any cleanup should be registered with t.Cleanup.  Run closes the
+// datastore when each test is done with it.
+type Factory func(t *testing.T) hare.Datastore
+
+var seedRecs = map[int]string{
+	1: `{"id":1,"first_name":"John","last_name":"Doe","age":37}`,
+	2: `{"id":2,"first_name":"Abe","last_name":"Lincoln","age":52}`,
+	3: `{"id":3,"first_name":"Bill","last_name":"Shakespeare","age":18}`,
+	4: `{"id":4,"first_name":"Helen","last_name":"Keller","age":25}`,
+}
+
+// Run takes the running test and a Factory and runs every conformance
+// test against datastores made by the Factory.
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, hare.Datastore)
+	}{
+		{"TableLifecycle", testTableLifecycle},
+		{"NoTable", testNoTable},
+		{"Records", testRecords},
+		{"NoRecord", testNoRecord},
+		{"IDExists", testIDExists},
+		{"GetLastID", testGetLastID},
+		{"Sequence", testSequence},
+		{"Keyed", testKeyed},
+		{"Batch", testBatch},
+		{"ConcurrentAccess", testConcurrentAccess},
+		{"ConcurrentReads", testConcurrentReads},
+		{"ConcurrentTables", testConcurrentTables},
+		{"Closed", testClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds := newStore(t)
+			defer ds.Close()
+
+			tt.fn(t, ds)
+		})
+	}
+}
+
+func testTableLifecycle(t *testing.T, ds hare.Datastore) {
+	if got := ds.TableNames(); len(got) != 0 {
+		t.Fatalf("new datastore: want no tables; got %v", got)
+	}
+
+	if ds.TableExists("contacts") {
+		t.Errorf("TableExists before CreateTable: want false; got true")
+	}
+
+	if err := ds.CreateTable("contacts"); err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+
+	if err := ds.CreateTable("newtable"); err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+
+	if !ds.TableExists("contacts") {
+		t.Errorf("TableExists after CreateTable: want true; got false")
+	}
+
+	checkErr(t, "CreateTable on existing table", dberr.ErrTableExists, ds.CreateTable("contacts"))
+
+	want := []string{"contacts", "newtable"}
+	got := ds.TableNames()
+	sort.Strings(got)
+
+	if fmt.Sprint(want) != fmt.Sprint(got) {
+		t.Errorf("TableNames: want %v; got %v", want, got)
+	}
+
+	ids, err := ds.IDs("newtable")
+	if err != nil {
+		t.Fatalf("IDs: %v", err)
+	}
+	if len(ids) != 0 {
+		t.Errorf("IDs of new table: want none; got %v", ids)
+	}
+
+	if err := ds.RemoveTable("newtable"); err != nil {
+		t.Fatalf("RemoveTable: %v", err)
+	}
+
+	if ds.TableExists("newtable") {
+		t.Errorf("TableExists after RemoveTable: want false; got true")
+	}
+
+	checkErr(t, "RemoveTable on removed table", dberr.ErrNoTable, ds.RemoveTable("newtable"))
+
+	// A removed table can be created again, and starts out empty.
+	if err := ds.CreateTable("contacts2"); err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+	if err := ds.InsertRec("contacts2", 1, []byte(seedRecs[1])); err != nil {
+		t.Fatalf("InsertRec: %v", err)
+	}
+	if err := ds.RemoveTable("contacts2"); err != nil {
+		t.Fatalf("RemoveTable: %v", err)
+	}
+	if err := ds.CreateTable("contacts2"); err != nil {
+		t.Fatalf("CreateTable after RemoveTable: %v", err)
+	}
+
+	ids, err = ds.IDs("contacts2")
+	if err != nil {
+		t.Fatalf("IDs: %v", err)
+	}
+	if len(ids) != 0 {
+		t.Errorf("IDs of recreated table: want none; got %v", ids)
+	}
+}
+
+func testNoTable(t *testing.T, ds hare.Datastore) {
+	const name = "nonexistent"
+
+	checkErr(t, "DeleteRec", dberr.ErrNoTable, ds.DeleteRec(name, 1))
+
+	_, err := ds.GetLastID(name)
+	checkErr(t, "GetLastID", dberr.ErrNoTable, err)
+
+	_, err = ds.IDs(name)
+	checkErr(t, "IDs", dberr.ErrNoTable, err)
+
+	checkErr(t, "InsertRec", dberr.ErrNoTable, ds.InsertRec(name, 1, []byte(seedRecs[1])))
+
+	_, err = ds.ReadRec(name, 1)
+	checkErr(t, "ReadRec", dberr.ErrNoTable, err)
+
+	checkErr(t, "RemoveTable", dberr.ErrNoTable, ds.RemoveTable(name))
+
+	checkErr(t, "UpdateRec", dberr.ErrNoTable, ds.UpdateRec(name, 1, []byte(seedRecs[1])))
+}
+
+// testClosed checks that every method returns dberr.ErrClosed once the
+// datastore is closed, and that closing it again does nothing.
+func testClosed(t *testing.T, ds hare.Datastore) {
+	seed(t, ds, "contacts")
+
+	if err := ds.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if err := ds.Close(); err != nil {
+		t.Errorf("Close (twice): want %v; got %v", nil, err)
+	}
+
+	checkErr(t, "CreateTable", dberr.ErrClosed, ds.CreateTable("newtable"))
+
+	checkErr(t, "DeleteRec", dberr.ErrClosed, ds.DeleteRec("contacts", 1))
+
+	_, err := ds.GetLastID("contacts")
+	checkErr(t, "GetLastID", dberr.ErrClosed, err)
+
+	_, err = ds.IDs("contacts")
+	checkErr(t, "IDs", dberr.ErrClosed, err)
+
+	checkErr(t, "InsertRec", dberr.ErrClosed, ds.InsertRec("contacts", 5, []byte(seedRecs[1])))
+
+	_, err = ds.ReadRec("contacts", 1)
+	checkErr(t, "ReadRec", dberr.ErrClosed, err)
+
+	checkErr(t, "RemoveTable", dberr.ErrClosed, ds.RemoveTable("contacts"))
+
+	checkErr(t, "UpdateRec", dberr.ErrClosed, ds.UpdateRec("contacts", 1, []byte(seedRecs[1])))
+
+	if ds.TableExists("contacts") {
+		t.Errorf("TableExists: want %v; got %v", false, true)
+	}
+
+	if names := ds.TableNames(); len(names) != 0 {
+		t.Errorf("TableNames: want %v; got %v", nil, names)
+	}
+}
+
+func testRecords(t *testing.T, ds hare.Datastore) {
+	seed(t, ds, "contacts")
+
+	for id, want := range seedRecs {
+		checkRec(t, ds, "contacts", id, want)
+	}
+
+	ids, err := ds.IDs("contacts")
+	if err != nil {
+		t.Fatalf("IDs: %v", err)
+	}
+	sort.Ints(ids)
+
+	if want := "[1 2 3 4]"; want != fmt.Sprint(ids) {
+		t.Errorf("IDs: want %v; got %v", want, ids)
+	}
+
+	// A longer record, then a shorter one, in place of the old one.
+	longer := `{"id":3,"first_name":"William","last_name":"Shakespeare","age":18,"born":1564}`
+	if err := ds.UpdateRec("contacts", 3, []byte(longer)); err != nil {
+		t.Fatalf("UpdateRec: %v", err)
+	}
+	checkRec(t, ds, "contacts", 3, longer)
+
+	shorter := `{"id":3,"first_name":"Bill"}`
+	if err := ds.UpdateRec("contacts", 3, []byte(shorter)); err != nil {
+		t.Fatalf("UpdateRec: %v", err)
+	}
+	checkRec(t, ds, "contacts", 3, shorter)
+
+	if err := ds.DeleteRec("contacts", 2); err != nil {
+		t.Fatalf("DeleteRec: %v", err)
+	}
+
+	_, err = ds.ReadRec("contacts", 2)
+	checkErr(t, "ReadRec of deleted record", dberr.ErrNoRecord, err)
+
+	ids, err = ds.IDs("contacts")
+	if err != nil {
+		t.Fatalf("IDs: %v", err)
+	}
+	sort.Ints(ids)
+
+	if want := "[1 3 4]"; want != fmt.Sprint(ids) {
+		t.Errorf("IDs after DeleteRec: want %v; got %v", want, ids)
+	}
+
+	// The other records are untouched by all of the above.
+	checkRec(t, ds, "contacts", 1, seedRecs[1])
+	checkRec(t, ds, "contacts", 4, seedRecs[4])
+
+	// Space freed by a delete may be reused, without harm to the
+	// record written there.
+	rec := `{"id":5,"first_name":"Rex","last_name":"Stout","age":77}`
+	if err := ds.InsertRec("contacts", 5, []byte(rec)); err != nil {
+		t.Fatalf("InsertRec: %v", err)
+	}
+	checkRec(t, ds, "contacts", 5, rec)
+}
+
+func testNoRecord(t *testing.T, ds hare.Datastore) {
+	seed(t, ds, "contacts")
+
+	checkErr(t, "DeleteRec", dberr.ErrNoRecord, ds.DeleteRec("contacts", 99))
+
+	_, err := ds.ReadRec("contacts", 99)
+	checkErr(t, "ReadRec", dberr.ErrNoRecord, err)
+
+	checkErr(t, "UpdateRec", dberr.ErrNoRecord, ds.UpdateRec("contacts", 99, []byte(`{"id":99}`)))
+
+	_, err = ds.ReadRec("contacts", 99)
+	checkErr(t, "ReadRec after failed UpdateRec", dberr.ErrNoRecord, err)
+}
+
+func testIDExists(t *testing.T, ds hare.Datastore) {
+	seed(t, ds, "contacts")
+
+	checkErr(t, "InsertRec", dberr.ErrIDExists, ds.InsertRec("contacts", 3, []byte(`{"id":3,"first_name":"Rex"}`)))
+
+	checkRec(t, ds, "contacts", 3, seedRecs[3])
+}
+
+func testGetLastID(t *testing.T, ds hare.Datastore) {
+	if err := ds.CreateTable("contacts"); err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+
+	checkLastID(t, ds, "empty table", 0)
+
+	seed(t, ds, "contacts")
+	checkLastID(t, ds, "after inserts", 4)
+
+	if err := ds.DeleteRec("contacts", 2); err != nil {
+		t.Fatalf("DeleteRec: %v", err)
+	}
+	checkLastID(t, ds, "after deleting a record that isn't the last", 4)
+
+	if err := ds.InsertRec("contacts", 10, []byte(`{"id":10}`)); err != nil {
+		t.Fatalf("InsertRec: %v", err)
+	}
+	checkLastID(t, ds, "after inserting a greater id", 10)
+}
+
+// testSequence checks a datastore that implements hare.Sequencer never
+// hands out an id that is in use or has been handed out before.
+func testSequence(t *testing.T, ds hare.Datastore) {
+	sequencer, ok := ds.(hare.Sequencer)
+	if !ok {
+		t.Skip("datastore does not implement hare.Sequencer")
+	}
+
+	_, err := sequencer.NextID("nonexistent")
+	checkErr(t, "NextID", dberr.ErrNoTable, err)
+
+	seed(t, ds, "contacts")
+	checkNextID(t, sequencer, "after inserts", 5)
+
+	if err := ds.InsertRec("contacts", 5, []byte(`{"id":5}`)); err != nil {
+		t.Fatalf("InsertRec: %v", err)
+	}
+	if err := ds.DeleteRec("contacts", 5); err != nil {
+		t.Fatalf("DeleteRec: %v", err)
+	}
+	if err := ds.DeleteRec("contacts", 4); err != nil {
+		t.Fatalf("DeleteRec: %v", err)
+	}
+	checkNextID(t, sequencer, "after deleting the last records", 6)
+
+	if err := ds.InsertRec("contacts", 10, []byte(`{"id":10}`)); err != nil {
+		t.Fatalf("InsertRec: %v", err)
+	}
+	checkNextID(t, sequencer, "after inserting a greater id", 11)
+
+	// Each table has its own sequence, which starts over when the
+	// table is removed.
+	if err := ds.CreateTable("other"); err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+
+	got, err := sequencer.NextID("other")
+	if err != nil {
+		t.Fatalf("NextID: %v", err)
+	}
+	if got != 1 {
+		t.Errorf("NextID of new table: want %v; got %v", 1, got)
+	}
+
+	if err := ds.RemoveTable("contacts"); err != nil {
+		t.Fatalf("RemoveTable: %v", err)
+	}
+	if err := ds.CreateTable("contacts"); err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+	checkNextID(t, sequencer, "of recreated table", 1)
+}
+
+// testBatch checks a datastore that implements hare.Batcher calls the
+// function it is given and keeps the changes it makes.
+func testBatch(t *testing.T, ds hare.Datastore) {
+	batcher, ok := ds.(hare.Batcher)
+	if !ok {
+		t.Skip("datastore does not implement hare.Batcher")
+	}
+
+	seed(t, ds, "contacts")
+
+	if err := ds.CreateTable("other"); err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+
+	err := batcher.Batch([]string{"contacts", "nonexistent"}, func() error {
+		t.Error("Batch called the function of a batch with a nonexistent table")
+		return nil
+	})
+	checkErr(t, "Batch", dberr.ErrNoTable, err)
+
+	err = batcher.Batch([]string{"contacts", "other"}, func() error {
+		if err := ds.UpdateRec("contacts", 3, []byte(`{"id":3,"first_name":"William","last_name":"Shakespeare","age":18}`)); err != nil {
+			return err
+		}
+
+		if err := ds.DeleteRec("contacts", 1); err != nil {
+			return err
+		}
+
+		return ds.InsertRec("other", 1, []byte(`{"id":1}`))
+	})
+	if err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+
+	checkRec(t, ds, "contacts", 3, `{"id":3,"first_name":"William","last_name":"Shakespeare","age":18}`)
+	checkRec(t, ds, "other", 1, `{"id":1}`)
+
+	_, err = ds.ReadRec("contacts", 1)
+	checkErr(t, "ReadRec of record deleted in batch", dberr.ErrNoRecord, err)
+
+	errFailed := errors.New("failed")
+
+	err = batcher.Batch([]string{"contacts"}, func() error {
+		return errFailed
+	})
+	checkErr(t, "Batch with failing function", errFailed, err)
+}
+
+// testKeyed checks a datastore that implements hare.KeyedStore keeps
+// records with string keys apart from records with int ids.
+func testKeyed(t *testing.T, ds hare.Datastore) {
+	keyed, ok := ds.(hare.KeyedStore)
+	if !ok {
+		t.Skip("datastore does not implement hare.KeyedStore")
+	}
+
+	checkErr(t, "InsertKeyedRec", dberr.ErrNoTable, keyed.InsertKeyedRec("nonexistent", "a", []byte(`{"id":"a"}`)))
+
+	seed(t, ds, "contacts")
+
+	recs := map[string]string{
+		"a": `{"id":"a","first_name":"Rex","last_name":"Stout"}`,
+		"b": `{"id":"b","first_name":"Nero","last_name":"Wolfe"}`,
+	}
+
+	for _, key := range []string{"a", "b"} {
+		if err := keyed.InsertKeyedRec("contacts", key, []byte(recs[key])); err != nil {
+			t.Fatalf("InsertKeyedRec: %v", err)
+		}
+	}
+
+	checkErr(t, "InsertKeyedRec", dberr.ErrIDExists, keyed.InsertKeyedRec("contacts", "a", []byte(recs["a"])))
+
+	keys, err := keyed.Keys("contacts")
+	if err != nil {
+		t.Fatalf("Keys: %v", err)
+	}
+	sort.Strings(keys)
+
+	if want := "[a b]"; want != fmt.Sprint(keys) {
+		t.Errorf("Keys: want %v; got %v", want, keys)
+	}
+
+	ids, err := ds.IDs("contacts")
+	if err != nil {
+		t.Fatalf("IDs: %v", err)
+	}
+	if len(ids) != len(seedRecs) {
+		t.Errorf("IDs: want %v ids; got %v", len(seedRecs), ids)
+	}
+
+	longer := `{"id":"a","first_name":"Rex","last_name":"Stout","born":1886}`
+	if err := keyed.UpdateKeyedRec("contacts", "a", []byte(longer)); err != nil {
+		t.Fatalf("UpdateKeyedRec: %v", err)
+	}
+
+	rec, err := keyed.ReadKeyedRec("contacts", "a")
+	if err != nil {
+		t.Fatalf("ReadKeyedRec: %v", err)
+	}
+	if got := string(bytes.TrimSuffix(rec, []byte("\n"))); longer != got {
+		t.Errorf("ReadKeyedRec: want %v; got %v", longer, got)
+	}
+
+	if err := keyed.DeleteKeyedRec("contacts", "b"); err != nil {
+		t.Fatalf("DeleteKeyedRec: %v", err)
+	}
+
+	_, err = keyed.ReadKeyedRec("contacts", "b")
+	checkErr(t, "ReadKeyedRec of deleted record", dberr.ErrNoRecord, err)
+	checkErr(t, "DeleteKeyedRec", dberr.ErrNoRecord, keyed.DeleteKeyedRec("contacts", "b"))
+	checkErr(t, "UpdateKeyedRec", dberr.ErrNoRecord, keyed.UpdateKeyedRec("contacts", "b", []byte(recs["b"])))
+
+	for id, want := range seedRecs {
+		checkRec(t, ds, "contacts", id, want)
+	}
+}
+
+// testConcurrentAccess uses the datastore from many goroutines at once,
+// each with its own table, the way hare.Database does when it holds a
+// separate lock for each table.
+func testConcurrentAccess(t *testing.T, ds hare.Datastore) {
+	const workers = 8
+	const recsPerWorker = 25
+
+	for w := 0; w < workers; w++ {
+		if err := ds.CreateTable(fmt.Sprintf("table%d", w)); err != nil {
+			t.Fatalf("CreateTable: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func(tableName string) {
+			defer wg.Done()
+
+			for id := 1; id <= recsPerWorker; id++ {
+				rec := fmt.Sprintf(`{"id":%d,"name":"rec %d"}`, id, id)
+				if err := ds.InsertRec(tableName, id, []byte(rec)); err != nil {
+					errs <- err
+					return
+				}
+
+				rec = fmt.Sprintf(`{"id":%d,"name":"updated rec %d"}`, id, id)
+				if err := ds.UpdateRec(tableName, id, []byte(rec)); err != nil {
+					errs <- err
+					return
+				}
+
+				got, err := ds.ReadRec(tableName, id)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				if string(bytes.TrimSuffix(got, []byte("\n"))) != rec {
+					errs <- fmt.Errorf("%s record %d: want %s; got %s", tableName, id, rec, got)
+					return
+				}
+
+				if id%2 == 0 {
+					if err := ds.DeleteRec(tableName, id); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}(fmt.Sprintf("table%d", w))
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for w := 0; w < workers; w++ {
+		ids, err := ds.IDs(fmt.Sprintf("table%d", w))
+		if err != nil {
+			t.Fatalf("IDs: %v", err)
+		}
+
+		if want := recsPerWorker - recsPerWorker/2; len(ids) != want {
+			t.Errorf("table%d: want %d records; got %d", w, want, len(ids))
+		}
+	}
+}
+
+// testConcurrentReads reads one table from many goroutines at once, the
+// way hare.Database does when its readers share a table's read lock.
+func testConcurrentReads(t *testing.T, ds hare.Datastore) {
+	const readers = 16
+	const readsPerReader = 100
+
+	seed(t, ds, "contacts")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, readers)
+
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+
+		go func(r int) {
+			defer wg.Done()
+
+			for i := 0; i < readsPerReader; i++ {
+				id := (r+i)%len(seedRecs) + 1
+
+				got, err := ds.ReadRec("contacts", id)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				if string(bytes.TrimSuffix(got, []byte("\n"))) != seedRecs[id] {
+					errs <- fmt.Errorf("record %d: want %s; got %s", id, seedRecs[id], got)
+					return
+				}
+			}
+		}(r)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// testConcurrentTables creates and removes a table over and over while
+// another table is read, the way hare.Database does when one goroutine
+// drops a table that others aren't using.
+func testConcurrentTables(t *testing.T, ds hare.Datastore) {
+	const readers = 4
+	const cycles = 25
+
+	seed(t, ds, "contacts")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, readers+1)
+	done := make(chan struct{})
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		defer close(done)
+
+		for i := 0; i < cycles; i++ {
+			if err := ds.CreateTable("newtable"); err != nil {
+				errs <- fmt.Errorf("CreateTable: %w", err)
+				return
+			}
+
+			if err := ds.RemoveTable("newtable"); err != nil {
+				errs <- fmt.Errorf("RemoveTable: %w", err)
+				return
+			}
+		}
+	}()
+
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				ds.TableExists("newtable")
+				ds.TableNames()
+
+				if _, err := ds.ReadRec("contacts", 1); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func seed(t *testing.T, ds hare.Datastore, tableName string) {
+	t.Helper()
+
+	if !ds.TableExists(tableName) {
+		if err := ds.CreateTable(tableName); err != nil {
+			t.Fatalf("CreateTable: %v", err)
+		}
+	}
+
+	for id := 1; id <= len(seedRecs); id++ {
+		if err := ds.InsertRec(tableName, id, []byte(seedRecs[id])); err != nil {
+			t.Fatalf("InsertRec: %v", err)
+		}
+	}
+}
+
+func checkRec(t *testing.T, ds hare.Datastore, tableName string, id int, want string) {
+	t.Helper()
+
+	rec, err := ds.ReadRec(tableName, id)
+	if err != nil {
+		t.Fatalf("ReadRec %s %d: %v", tableName, id, err)
+	}
+
+	if got := string(bytes.TrimSuffix(rec, []byte("\n"))); want != got {
+		t.Errorf("ReadRec %s %d: want %v; got %v", tableName, id, want, got)
+	}
+}
+
+func checkLastID(t *testing.T, ds hare.Datastore, desc string, want int) {
+	t.Helper()
+
+	got, err := ds.GetLastID("contacts")
+	if err != nil {
+		t.Fatalf("GetLastID: %v", err)
+	}
+
+	if want != got {
+		t.Errorf("GetLastID %s: want %v; got %v", desc, want, got)
+	}
+}
+
+func checkNextID(t *testing.T, sequencer hare.Sequencer, desc string, want int) {
+	t.Helper()
+
+	got, err := sequencer.NextID("contacts")
+	if err != nil {
+		t.Fatalf("NextID: %v", err)
+	}
+
+	if want != got {
+		t.Errorf("NextID %s: want %v; got %v", desc, want, got)
+	}
+}
+
+func checkErr(t *testing.T, desc string, wantErr error, gotErr error) {
+	t.Helper()
+
+	if !errors.Is(gotErr, wantErr) {
+		t.Errorf("%s: want %v; got %v", desc, wantErr, gotErr)
+	}
+}
@@ -0,0 +1,226 @@
+package disk
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// Fragmentation describes how much of a table file is taken up by the
+// dummy records left behind by deleted and updated records.
+type Fragmentation struct {
+	// LiveBytes is the number of bytes taken up by records.
+	LiveBytes int64
+	// DeadBytes is the number of bytes taken up by dummy records,
+	// which compacting the table would reclaim.
+	DeadBytes int64
+}
+
+// Ratio returns the ratio of dead bytes to live bytes.
+func (f Fragmentation) Ratio() float64 {
+	if f.DeadBytes == 0 {
+		return 0
+	}
+
+	if f.LiveBytes == 0 {
+		return math.Inf(1)
+	}
+
+	return float64(f.DeadBytes) / float64(f.LiveBytes)
+}
+
+// CompactThreshold is the fragmentation at which a table is compacted
+// automatically: a ratio of dead to live bytes of at least Ratio, with
+// at least MinDeadBytes dead bytes.
+type CompactThreshold struct {
+	Ratio        float64
+	MinDeadBytes int64
+}
+
+func (c CompactThreshold) crossed(f Fragmentation) bool {
+	return f.DeadBytes > 0 && f.DeadBytes >= c.MinDeadBytes && f.Ratio() >= c.Ratio
+}
+
+// WithAutoCompact takes a CompactThreshold and returns an Option that
+// compacts a table in the background whenever a change to it leaves it
+// past the threshold.  Until the compaction is done, the table's other
+// operations wait for it.
+func WithAutoCompact(threshold CompactThreshold) Option {
+	return func(dsk *Disk) {
+		dsk.autoCompact = &threshold
+	}
+}
+
+// WithCompactOnClose takes a CompactThreshold and returns an Option that
+// compacts every table past the threshold when the datastore is closed.
+func WithCompactOnClose(threshold CompactThreshold) Option {
+	return func(dsk *Disk) {
+		dsk.compactOnClose = &threshold
+	}
+}
+
+// CompactTable takes a table name and compacts that table file on the
+// disk.
+func (dsk *Disk) CompactTable(tableName string) error {
+	_, err := dsk.CompactTableReport(tableName)
+
+	return err
+}
+
+// CompactTableReport takes a table name, compacts that table file on the
+// disk and returns the number of bytes reclaimed.  The live records are
+// copied, in the order they are stored, to a new file, which is synced
+// and then renamed over the table file, so a crash leaves either the old
+// file or the new one.
+func (dsk *Disk) CompactTableReport(tableName string) (int64, error) {
+	tableFile, err := dsk.lockTableFile(tableName)
+	if err != nil {
+		return 0, err
+	}
+	defer tableFile.mu.Unlock()
+
+	return dsk.compactFile(tableName, tableFile)
+}
+
+// Fragmentation takes a table name and returns how much of its table
+// file is taken up by records and by dummy records.
+func (dsk *Disk) Fragmentation(tableName string) (Fragmentation, error) {
+	tableFile, err := dsk.rlockTableFile(tableName)
+	if err != nil {
+		return Fragmentation{}, err
+	}
+	defer tableFile.mu.RUnlock()
+
+	return tableFile.fragmentation()
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+// compactFile compacts a table file.  The caller holds the table file's
+// lock.
+func (dsk *Disk) compactFile(tableName string, tableFile *tableFile) (int64, error) {
+	// The transaction log points into the table file, so a table can't
+	// be replaced while a batch is changing it.
+	if tableFile.txlog != nil {
+		if inBatch, err := tableFile.txlog.holds(tableName); inBatch || err != nil {
+			return 0, err
+		}
+	}
+
+	// Changes held back by the sync policy are still in the write-ahead
+	// log, which must be empty before the table file is replaced.
+	if tableFile.wal != nil {
+		if err := tableFile.wal.sync(); err != nil {
+			return 0, err
+		}
+	}
+
+	tablePath := filepath.Join(dsk.path, tableName+dsk.ext)
+	tmpPath := tablePath + ".tmp"
+
+	c, err := tableFile.copyLive(tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+
+	if err := os.Rename(tmpPath, tablePath); err != nil {
+		c.ptr.Close()
+		os.Remove(tmpPath)
+		return 0, err
+	}
+
+	// The table file is now the new file, so the table is switched to
+	// it whatever happens next.  The log is switched before the old file
+	// is closed, since Disk.Sync syncs the log without the table file's
+	// lock.
+	oldPtr := tableFile.ptr
+
+	if tableFile.wal != nil {
+		tableFile.wal.setTable(c.ptr)
+	}
+
+	tableFile.ptr = c.ptr
+	tableFile.offsets = c.offsets
+	tableFile.keys = c.keys
+	tableFile.free = freeList{}
+
+	oldPtr.Close()
+
+	if err := syncDir(dsk.path); err != nil {
+		return 0, err
+	}
+
+	return c.oldSize - c.newSize, nil
+}
+
+// maybeCompact starts compacting a table in the background if automatic
+// compaction is on and the table is past its threshold.  The caller
+// holds the table file's lock, which the compaction waits for.
+func (dsk *Disk) maybeCompact(tableName string, tableFile *tableFile) {
+	if dsk.autoCompact == nil || dsk.lockMode == LockShared {
+		return
+	}
+
+	f, err := tableFile.fragmentation()
+	if err != nil || !dsk.autoCompact.crossed(f) {
+		return
+	}
+
+	// Once the datastore is closing, Close is waiting on compactions and
+	// no more may be started.
+	dsk.mu.RLock()
+	defer dsk.mu.RUnlock()
+
+	if dsk.closed || !tableFile.compacting.CompareAndSwap(false, true) {
+		return
+	}
+
+	dsk.compactions.Add(1)
+
+	go func() {
+		defer dsk.compactions.Done()
+		defer tableFile.compacting.Store(false)
+
+		tableFile.mu.Lock()
+		defer tableFile.mu.Unlock()
+
+		// The table may have been compacted or removed in the meantime.
+		if tableFile.closed {
+			return
+		}
+
+		f, err := tableFile.fragmentation()
+		if err == nil && dsk.autoCompact.crossed(f) {
+			_, err = dsk.compactFile(tableName, tableFile)
+		}
+
+		if err != nil {
+			dsk.setCompactErr(err)
+		}
+	}()
+}
+
+// setCompactErr keeps the first error from a background compaction, to
+// be returned by Close.
+func (dsk *Disk) setCompactErr(err error) {
+	dsk.compactErrMu.Lock()
+	defer dsk.compactErrMu.Unlock()
+
+	if dsk.compactErr == nil {
+		dsk.compactErr = err
+	}
+}
+
+// fragmentation returns how much of the table file is taken up by
+// records and by dummy records.
+func (t *tableFile) fragmentation() (Fragmentation, error) {
+	fi, err := t.ptr.Stat()
+	if err != nil {
+		return Fragmentation{}, err
+	}
+
+	return Fragmentation{LiveBytes: fi.Size() - t.free.bytes, DeadBytes: t.free.bytes}, nil
+}
@@ -0,0 +1,210 @@
+package disk
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestFragmentationTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//Fragmentation...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			want := Fragmentation{LiveBytes: 239, DeadBytes: 45}
+			got, err := dsk.Fragmentation("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			if err := dsk.DeleteRec("contacts", 2); err != nil {
+				t.Fatal(err)
+			}
+
+			want = Fragmentation{LiveBytes: 180, DeadBytes: 104}
+			got, err = dsk.Fragmentation("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			wantRatio := 104.0 / 180.0
+			if gotRatio := got.Ratio(); wantRatio != gotRatio {
+				t.Errorf("want %v; got %v", wantRatio, gotRatio)
+			}
+		},
+		func(t *testing.T) {
+			//WithAutoCompact...
+
+			dsk := newTestDisk(t, WithAutoCompact(CompactThreshold{Ratio: 0.5}))
+			defer dsk.Close()
+
+			// 45 dead bytes to 239 live isn't enough.
+			if err := dsk.UpdateRec("contacts", 1, []byte(`{"id":1,"first_name":"John","last_name":"Doe","age":38}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk.compactions.Wait()
+
+			got, err := dsk.Fragmentation("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := int64(45); want != got.DeadBytes {
+				t.Errorf("want %v; got %v", want, got.DeadBytes)
+			}
+
+			// 104 dead bytes to 180 live is.
+			if err := dsk.DeleteRec("contacts", 2); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk.compactions.Wait()
+
+			want := Fragmentation{LiveBytes: 180}
+			got, err = dsk.Fragmentation("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			rec, err := dsk.ReadRec("contacts", 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantRec := `{"id":4,"first_name":"Helen","last_name":"Keller","age":25}` + "\n"
+			if wantRec != string(rec) {
+				t.Errorf("want %v; got %v", wantRec, string(rec))
+			}
+		},
+		func(t *testing.T) {
+			//WithAutoCompact (concurrent readers)...
+
+			dsk := newTestDisk(t, WithAutoCompact(CompactThreshold{Ratio: 0.1}))
+			defer dsk.Close()
+
+			var wg sync.WaitGroup
+			errs := make(chan error, 9)
+
+			for r := 0; r < 8; r++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					for i := 0; i < 200; i++ {
+						if _, err := dsk.ReadRec("contacts", 3); err != nil {
+							errs <- err
+							return
+						}
+					}
+				}()
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for id := 5; id < 50; id++ {
+					rec := fmt.Sprintf(`{"id":%d,"first_name":"Jane","last_name":"Doe","age":%d}`, id, id)
+					if err := dsk.InsertRec("contacts", id, []byte(rec)); err != nil {
+						errs <- err
+						return
+					}
+
+					if err := dsk.DeleteRec("contacts", id); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				t.Error(err)
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+		},
+		func(t *testing.T) {
+			//CompactTable (concurrent Sync)...
+
+			dsk := newTestDisk(t, WithSync(SyncEvery(0, 100)))
+			defer dsk.Close()
+
+			done := make(chan struct{})
+			errs := make(chan error, 1)
+
+			go func() {
+				defer close(errs)
+
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+
+					if err := dsk.Sync(); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+
+			for i := 0; i < 50; i++ {
+				rec := fmt.Sprintf(`{"id":3,"first_name":"Bill","last_name":"Shakespeare","age":%d}`, i)
+				if err := dsk.UpdateRec("contacts", 3, []byte(rec)); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := dsk.CompactTable("contacts"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			close(done)
+
+			for err := range errs {
+				t.Error(err)
+			}
+		},
+		func(t *testing.T) {
+			//WithCompactOnClose...
+
+			dsk := newTestDisk(t, WithCompactOnClose(CompactThreshold{Ratio: 0.1}))
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			fi, err := os.Stat("./testdata/contacts.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := int64(239)
+			got := fi.Size()
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
@@ -0,0 +1,19 @@
+package disk
+
+import (
+	"testing"
+
+	"github.com/jameycribbs/hare"
+	"github.com/jameycribbs/hare/datastores/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) hare.Datastore {
+		dsk, err := New(t.TempDir(), ".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return dsk
+	})
+}
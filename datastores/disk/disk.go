@@ -1,83 +1,174 @@
 package disk
 
 import (
-	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/jameycribbs/hare/codec"
 	"github.com/jameycribbs/hare/dberr"
 )
 
+// seqExt is the extension of the file that holds a table's id
+// sequence, alongside the table file.
+const seqExt = ".seq"
+
 // Disk is a struct that holds a map of all the
 // table files in a database directory.
 type Disk struct {
-	path       string
-	ext        string
-	tableFiles map[string]*tableFile
+	path        string
+	ext         string
+	mu          sync.RWMutex
+	tableFiles  map[string]*tableFile
+	closed      bool
+	codec       codec.Codec
+	codecs      map[string]codec.Codec
+	sync        SyncPolicy
+	syncs       map[string]SyncPolicy
+	lockMode    LockMode
+	lockPtr     *os.File
+	txlog       *txLog
+	offsetIndex bool
+	recovery    bool
+	quarantined []QuarantinedLine
+
+	autoCompact    *CompactThreshold
+	compactOnClose *CompactThreshold
+	compactions    sync.WaitGroup
+	compactErrMu   sync.Mutex
+	compactErr     error
 }
 
-// New takes a datastorage path and an extension
-// and returns a pointer to a Disk struct.
-func New(path string, ext string) (*Disk, error) {
-	var dsk Disk
+// Option is a setting that can be passed to New.
+type Option func(*Disk)
 
-	dsk.path = path
-	dsk.ext = ext
+// WithCodec takes a Codec and returns an Option that makes it the codec
+// used to read record ids from table files, for every table that
+// hasn't been given one with WithTableCodec.  It should be the same
+// codec the Database is given.  The default is codec.JSON.
+func WithCodec(c codec.Codec) Option {
+	return func(dsk *Disk) {
+		dsk.codec = c
+	}
+}
+
+// WithTableCodec takes a table name and a Codec and returns an Option
+// that makes it the codec used to read record ids from that table's
+// file.
+func WithTableCodec(tableName string, c codec.Codec) Option {
+	return func(dsk *Disk) {
+		dsk.codecs[tableName] = c
+	}
+}
+
+// New takes a datastorage path, an extension and any number of
+// Options and returns a pointer to a Disk struct.
+func New(path string, ext string, opts ...Option) (*Disk, error) {
+	dsk := newDisk(path, ext, opts)
+
+	if err := dsk.lock(); err != nil {
+		return nil, err
+	}
 
 	if err := dsk.init(); err != nil {
+		for _, tableFile := range dsk.tableFiles {
+			tableFile.close()
+		}
+		if dsk.txlog != nil {
+			dsk.txlog.close()
+		}
+		dsk.unlock()
 		return nil, err
 	}
 
-	return &dsk, nil
+	return dsk, nil
 }
 
-// Close closes the datastore.
+// Close waits for background compactions and for the operations under
+// way on each table, compacts the tables past the WithCompactOnClose
+// threshold, closes every table file, even if one fails to, and releases
+// the lock on the database directory.  It returns the first error,
+// including one from a background compaction.  Afterwards, every method
+// returns dberr.ErrClosed and Close does nothing.
 func (dsk *Disk) Close() error {
-	for _, tableFile := range dsk.tableFiles {
-		if err := tableFile.close(); err != nil {
-			return err
+	dsk.mu.Lock()
+	if dsk.closed {
+		dsk.mu.Unlock()
+		return nil
+	}
+	dsk.closed = true
+	tableFiles := dsk.tableFiles
+	dsk.mu.Unlock()
+
+	dsk.compactions.Wait()
+
+	var firstErr error
+
+	for tableName, tableFile := range tableFiles {
+		if err := dsk.closeTableFile(tableName, tableFile); err != nil && firstErr == nil {
+			firstErr = err
 		}
 	}
 
+	if dsk.txlog != nil {
+		if err := dsk.txlog.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	dsk.mu.Lock()
 	dsk.path = ""
 	dsk.ext = ""
 	dsk.tableFiles = nil
+	dsk.mu.Unlock()
 
-	return nil
+	if err := dsk.unlock(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return dsk.compactErr
 }
 
 // CreateTable takes a table name, creates a new disk
 // file, and adds it to the map of tables in the
 // datastore.
 func (dsk *Disk) CreateTable(tableName string) error {
-	if dsk.TableExists(tableName) {
-		return dberr.ErrTableExists
-	}
-
-	filePtr, err := dsk.openFile(tableName, true)
-	if err != nil {
+	if err := dsk.writable(); err != nil {
 		return err
 	}
 
-	tableFile, err := newTableFile(tableName, filePtr)
-	if err != nil {
-		return err
+	dsk.mu.Lock()
+	defer dsk.mu.Unlock()
+
+	if dsk.closed {
+		return dberr.ErrClosed
 	}
 
-	dsk.tableFiles[tableName] = tableFile
+	if _, ok := dsk.tableFiles[tableName]; ok {
+		return dberr.ErrTableExists
+	}
 
-	return nil
+	return dsk.openTable(tableName, true)
 }
 
 // DeleteRec takes a table name and a record id and deletes
 // the associated record.
 func (dsk *Disk) DeleteRec(tableName string, id int) error {
-	tableFile, err := dsk.getTableFile(tableName)
+	tableFile, err := dsk.lockTableFile(tableName)
 	if err != nil {
 		return err
 	}
+	defer tableFile.mu.Unlock()
+	defer dsk.maybeCompact(tableName, tableFile)
 
 	if err = tableFile.deleteRec(id); err != nil {
 		return err
@@ -86,13 +177,27 @@ func (dsk *Disk) DeleteRec(tableName string, id int) error {
 	return nil
 }
 
+// DeleteKeyedRec takes a table name and a record key and deletes the
+// associated record.
+func (dsk *Disk) DeleteKeyedRec(tableName string, key string) error {
+	tableFile, err := dsk.lockTableFile(tableName)
+	if err != nil {
+		return err
+	}
+	defer tableFile.mu.Unlock()
+	defer dsk.maybeCompact(tableName, tableFile)
+
+	return tableFile.deleteKeyedRec(key)
+}
+
 // GetLastID takes a table name and returns the greatest record
 // id found in the table.
 func (dsk *Disk) GetLastID(tableName string) (int, error) {
-	tableFile, err := dsk.getTableFile(tableName)
+	tableFile, err := dsk.rlockTableFile(tableName)
 	if err != nil {
 		return 0, err
 	}
+	defer tableFile.mu.RUnlock()
 
 	return tableFile.getLastID(), nil
 }
@@ -100,10 +205,11 @@ func (dsk *Disk) GetLastID(tableName string) (int, error) {
 // IDs takes a table name and returns an array of all record IDs
 // found in the table.
 func (dsk *Disk) IDs(tableName string) ([]int, error) {
-	tableFile, err := dsk.getTableFile(tableName)
+	tableFile, err := dsk.rlockTableFile(tableName)
 	if err != nil {
 		return nil, err
 	}
+	defer tableFile.mu.RUnlock()
 
 	return tableFile.ids(), nil
 }
@@ -111,10 +217,12 @@ func (dsk *Disk) IDs(tableName string) ([]int, error) {
 // InsertRec takes a table name, a record id, and a byte array and adds
 // the record to the table.
 func (dsk *Disk) InsertRec(tableName string, id int, rec []byte) error {
-	tableFile, err := dsk.getTableFile(tableName)
+	tableFile, err := dsk.lockTableFile(tableName)
 	if err != nil {
 		return err
 	}
+	defer tableFile.mu.Unlock()
+	defer dsk.maybeCompact(tableName, tableFile)
 
 	ids := tableFile.ids()
 	for _, i := range ids {
@@ -123,27 +231,98 @@ func (dsk *Disk) InsertRec(tableName string, id int, rec []byte) error {
 		}
 	}
 
-	offset, err := tableFile.offsetForWritingRec(len(rec))
+	offset, err := tableFile.insertRec(rec)
 	if err != nil {
 		return err
 	}
 
-	if err := tableFile.writeRec(offset, 0, rec); err != nil {
+	tableFile.offsets[id] = offset
+
+	if id > tableFile.seq {
+		tableFile.seq = id
+	}
+
+	return nil
+}
+
+// InsertKeyedRec takes a table name, a record key, and a byte array and
+// adds the record to the table.
+func (dsk *Disk) InsertKeyedRec(tableName string, key string, rec []byte) error {
+	tableFile, err := dsk.lockTableFile(tableName)
+	if err != nil {
 		return err
 	}
+	defer tableFile.mu.Unlock()
+	defer dsk.maybeCompact(tableName, tableFile)
 
-	tableFile.offsets[id] = offset
+	if _, ok := tableFile.keys[key]; ok {
+		return dberr.ErrIDExists
+	}
+
+	offset, err := tableFile.insertRec(rec)
+	if err != nil {
+		return err
+	}
+
+	tableFile.keys[key] = offset
 
 	return nil
 }
 
+// Keys takes a table name and returns an array of all record keys
+// found in the table.
+func (dsk *Disk) Keys(tableName string) ([]string, error) {
+	tableFile, err := dsk.rlockTableFile(tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer tableFile.mu.RUnlock()
+
+	return tableFile.keyList(), nil
+}
+
+// NextID takes a table name, advances the table's id sequence and
+// returns its new value.  The sequence is saved in a file next to the
+// table file, so ids of deleted records are not handed out again, even
+// after the datastore is reopened.
+func (dsk *Disk) NextID(tableName string) (int, error) {
+	tableFile, err := dsk.lockTableFile(tableName)
+	if err != nil {
+		return 0, err
+	}
+	defer tableFile.mu.Unlock()
+
+	seq := tableFile.seq + 1
+
+	if err := dsk.writeSeq(tableName, seq); err != nil {
+		return 0, err
+	}
+
+	tableFile.seq = seq
+
+	return seq, nil
+}
+
+// ReadKeyedRec takes a table name and a key, reads the record from the
+// table, and returns a populated byte array.
+func (dsk *Disk) ReadKeyedRec(tableName string, key string) ([]byte, error) {
+	tableFile, err := dsk.rlockTableFile(tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer tableFile.mu.RUnlock()
+
+	return tableFile.readKeyedRec(key)
+}
+
 // ReadRec takes a table name and an id, reads the record from the
 // table, and returns a populated byte array.
 func (dsk *Disk) ReadRec(tableName string, id int) ([]byte, error) {
-	tableFile, err := dsk.getTableFile(tableName)
+	tableFile, err := dsk.rlockTableFile(tableName)
 	if err != nil {
 		return nil, err
 	}
+	defer tableFile.mu.RUnlock()
 
 	rec, err := tableFile.readRec(id)
 	if err != nil {
@@ -156,25 +335,76 @@ func (dsk *Disk) ReadRec(tableName string, id int) ([]byte, error) {
 // RemoveTable takes a table name and deletes that table file from the
 // disk.
 func (dsk *Disk) RemoveTable(tableName string) error {
-	tableFile, err := dsk.getTableFile(tableName)
+	tableFile, err := dsk.lockTableFile(tableName)
 	if err != nil {
 		return err
 	}
+	defer tableFile.mu.Unlock()
 
 	tableFile.close()
 
-	if err := os.Remove(dsk.getTablePath(tableName)); err != nil {
+	if err := os.Remove(filepath.Join(dsk.path, tableName+dsk.ext)); err != nil {
 		return err
 	}
 
+	for _, p := range []string{dsk.getSeqPath(tableName), dsk.getWALPath(tableName), dsk.getIdxPath(tableName)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	dsk.mu.Lock()
 	delete(dsk.tableFiles, tableName)
+	dsk.mu.Unlock()
 
 	return nil
 }
 
+// Scan takes a table name and calls fn with the id and the raw record
+// of every record in the table, in the order they are stored in the
+// table file.
+func (dsk *Disk) Scan(tableName string, fn func(id int, rec []byte) error) error {
+	tableFile, err := dsk.rlockTableFile(tableName)
+	if err != nil {
+		return err
+	}
+	defer tableFile.mu.RUnlock()
+
+	return tableFile.scan(fn)
+}
+
+// Snapshot takes a table name and returns a copy of every record in the
+// table, keyed by record id.
+func (dsk *Disk) Snapshot(tableName string) (map[int][]byte, error) {
+	tableFile, err := dsk.rlockTableFile(tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer tableFile.mu.RUnlock()
+
+	recs := make(map[int][]byte)
+
+	err = tableFile.scan(func(id int, rec []byte) error {
+		recs[id] = rec
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recs, nil
+}
+
 // TableExists takes a table name and returns a bool indicating
 // whether or not the table exists in the datastore.
 func (dsk *Disk) TableExists(tableName string) bool {
+	dsk.mu.RLock()
+	defer dsk.mu.RUnlock()
+
+	if dsk.closed {
+		return false
+	}
+
 	_, ok := dsk.tableFiles[tableName]
 
 	return ok
@@ -182,6 +412,13 @@ func (dsk *Disk) TableExists(tableName string) bool {
 
 // TableNames returns an array of table names.
 func (dsk *Disk) TableNames() []string {
+	dsk.mu.RLock()
+	defer dsk.mu.RUnlock()
+
+	if dsk.closed {
+		return nil
+	}
+
 	var names []string
 
 	for k := range dsk.tableFiles {
@@ -191,13 +428,28 @@ func (dsk *Disk) TableNames() []string {
 	return names
 }
 
+// UpdateKeyedRec takes a table name, a record key, and a byte array and
+// updates the table record with that key.
+func (dsk *Disk) UpdateKeyedRec(tableName string, key string, rec []byte) error {
+	tableFile, err := dsk.lockTableFile(tableName)
+	if err != nil {
+		return err
+	}
+	defer tableFile.mu.Unlock()
+	defer dsk.maybeCompact(tableName, tableFile)
+
+	return tableFile.updateKeyedRec(key, rec)
+}
+
 // UpdateRec takes a table name, a record id, and a byte array and updates
 // the table record with that id.
 func (dsk *Disk) UpdateRec(tableName string, id int, rec []byte) error {
-	tableFile, err := dsk.getTableFile(tableName)
+	tableFile, err := dsk.lockTableFile(tableName)
 	if err != nil {
 		return err
 	}
+	defer tableFile.mu.Unlock()
+	defer dsk.maybeCompact(tableName, tableFile)
 
 	if err = tableFile.updateRec(id, rec); err != nil {
 		return err
@@ -206,75 +458,114 @@ func (dsk *Disk) UpdateRec(tableName string, id int, rec []byte) error {
 	return nil
 }
 
-// CompactTable takes a table name and compacts that table file on the
-// disk. (Taken from the example)
-func (dsk *Disk) CompactTable(tableName string) error {
-	return dsk.compactFile(tableName)
-}
-
 //******************************************************************************
 // UNEXPORTED METHODS
 //******************************************************************************
 
-func (dsk *Disk) compactFile(tableName string) error {
-	tableFile, err := dsk.getTableFile(tableName)
-	if err != nil {
-		return err
+func (dsk *Disk) codecFor(tableName string) codec.Codec {
+	if c, ok := dsk.codecs[tableName]; ok {
+		return c
 	}
-	defer tableFile.close()
 
-	tablePath := dsk.getTablePath(tableName)
-	backupFilepath := strings.TrimSuffix(tablePath, dsk.ext) + ".old"
+	return dsk.codec
+}
 
-	cmd := exec.Command("cp", tablePath, backupFilepath)
-	if err := cmd.Run(); err != nil {
-		return err
+func (dsk *Disk) getTableFile(tableName string) (*tableFile, error) {
+	dsk.mu.RLock()
+	defer dsk.mu.RUnlock()
+
+	if dsk.closed {
+		return nil, dberr.ErrClosed
 	}
 
-	// copy all records
-	recs := make(map[int][]byte)
+	tableFile, ok := dsk.tableFiles[tableName]
+	if !ok {
+		return nil, dberr.ErrNoTable
+	}
+
+	return tableFile, nil
+}
+
+// getWritableTableFile is getTableFile for the methods that change a
+// table.
+func (dsk *Disk) getWritableTableFile(tableName string) (*tableFile, error) {
+	if err := dsk.writable(); err != nil {
+		return nil, err
+	}
 
-	ids, err := dsk.IDs(tableName)
+	return dsk.getTableFile(tableName)
+}
+
+// lockTableFile write locks a table's file, for the methods that change
+// a table.  It returns dberr.ErrNoTable if the table was removed while
+// waiting for the lock, and dberr.ErrClosed if the datastore was closed.
+func (dsk *Disk) lockTableFile(tableName string) (*tableFile, error) {
+	tableFile, err := dsk.getWritableTableFile(tableName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, id := range ids {
-		r, err := tableFile.readRec(id)
-		if err != nil {
-			return err
-		}
-		recs[id] = bytes.TrimSuffix(r, []byte("\n"))
+	tableFile.mu.Lock()
+
+	if err := dsk.checkOpen(tableFile); err != nil {
+		tableFile.mu.Unlock()
+		return nil, err
 	}
 
-	// backup table
-	err = dsk.RemoveTable(tableName)
+	return tableFile, nil
+}
+
+// rlockTableFile is lockTableFile for a read lock.
+func (dsk *Disk) rlockTableFile(tableName string) (*tableFile, error) {
+	tableFile, err := dsk.getTableFile(tableName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = dsk.CreateTable(tableName)
-	if err != nil {
-		return err
+	tableFile.mu.RLock()
+
+	if err := dsk.checkOpen(tableFile); err != nil {
+		tableFile.mu.RUnlock()
+		return nil, err
 	}
 
-	for id, rec := range recs {
-		err = dsk.InsertRec(tableName, id, rec)
-		if err != nil {
-			return err
-		}
+	return tableFile, nil
+}
+
+// checkOpen returns an error if a table file, whose lock the caller
+// holds, has been closed.
+func (dsk *Disk) checkOpen(tableFile *tableFile) error {
+	if !tableFile.closed {
+		return nil
 	}
 
-	return nil
+	dsk.mu.RLock()
+	defer dsk.mu.RUnlock()
+
+	if dsk.closed {
+		return dberr.ErrClosed
+	}
+
+	return dberr.ErrNoTable
 }
 
-func (dsk *Disk) getTableFile(tableName string) (*tableFile, error) {
-	tableFile, ok := dsk.tableFiles[tableName]
-	if !ok {
-		return nil, dberr.ErrNoTable
+// newDisk returns a Disk with the default settings and opts applied,
+// which has neither taken its lock nor opened its tables.
+func newDisk(path string, ext string, opts []Option) *Disk {
+	var dsk Disk
+
+	dsk.path = path
+	dsk.ext = ext
+	dsk.codec = codec.JSON
+	dsk.codecs = make(map[string]codec.Codec)
+	dsk.sync = SyncAlways
+	dsk.syncs = make(map[string]SyncPolicy)
+
+	for _, opt := range opts {
+		opt(&dsk)
 	}
 
-	return tableFile, nil
+	return &dsk
 }
 
 func (dsk *Disk) getTablePath(tableName string) string {
@@ -284,6 +575,14 @@ func (dsk *Disk) getTablePath(tableName string) string {
 	return ""
 }
 
+func (dsk *Disk) getSeqPath(tableName string) string {
+	return filepath.Join(dsk.path, tableName+seqExt)
+}
+
+func (dsk *Disk) getWALPath(tableName string) string {
+	return filepath.Join(dsk.path, tableName+walExt)
+}
+
 func (dsk *Disk) getTableNames() ([]string, error) {
 	var tableNames []string
 
@@ -304,33 +603,213 @@ func (dsk *Disk) getTableNames() ([]string, error) {
 func (dsk *Disk) init() error {
 	dsk.tableFiles = make(map[string]*tableFile)
 
+	if err := dsk.openTxLog(); err != nil {
+		return err
+	}
+
 	tableNames, err := dsk.getTableNames()
 	if err != nil {
 		return err
 	}
 
 	for _, tableName := range tableNames {
-		filePtr, err := dsk.openFile(tableName, false)
-		if err != nil {
+		if err := dsk.openTable(tableName, false); err != nil {
 			return err
 		}
+	}
+
+	return nil
+}
+
+// openTable opens a table file and its write-ahead log, replays any
+// change the log holds, and adds the table to the map of tables.  The
+// caller must hold the datastore's write lock, unless the datastore is
+// still being opened.
+func (dsk *Disk) openTable(tableName string, createIfNeeded bool) error {
+	filePtr, err := dsk.openFile(tableName, createIfNeeded)
+	if err != nil {
+		return err
+	}
+
+	if dsk.lockMode == LockShared {
+		return dsk.openTableReadOnly(tableName, filePtr)
+	}
+
+	w, err := openWAL(dsk.getWALPath(tableName), filePtr, dsk.syncFor(tableName))
+	if err != nil {
+		filePtr.Close()
+		return err
+	}
+
+	if err := w.replay(); err != nil {
+		w.close()
+		filePtr.Close()
+		return err
+	}
+
+	tableFile, skipped, err := dsk.newTableFile(tableName, filePtr)
+	if err != nil {
+		w.close()
+		filePtr.Close()
+		return err
+	}
+	tableFile.name = tableName
+	tableFile.wal = w
+	tableFile.txlog = dsk.txlog
+
+	if err := dsk.quarantine(tableName, tableFile, skipped); err != nil {
+		tableFile.close()
+		return err
+	}
+
+	dsk.tableFiles[tableName] = tableFile
+
+	return dsk.loadSeq(tableName)
+}
+
+// openTableReadOnly adds a table to the map of tables without a
+// write-ahead log.  A table whose log holds changes can't be opened this
+// way, because making them would mean writing to the table file.
+func (dsk *Disk) openTableReadOnly(tableName string, filePtr *os.File) error {
+	fi, err := os.Stat(dsk.getWALPath(tableName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		filePtr.Close()
+		return err
+	}
+
+	if err == nil && fi.Size() > 0 {
+		filePtr.Close()
+		return fmt.Errorf("disk: table %s has changes to recover, open it for writing first: %w", tableName, dberr.ErrReadOnly)
+	}
+
+	tableFile, skipped, err := dsk.newTableFile(tableName, filePtr)
+	if err != nil {
+		filePtr.Close()
+		return err
+	}
+
+	if err := dsk.quarantine(tableName, tableFile, skipped); err != nil {
+		tableFile.close()
+		return err
+	}
 
-		tableFile, err := newTableFile(tableName, filePtr)
+	dsk.tableFiles[tableName] = tableFile
+
+	return dsk.loadSeq(tableName)
+}
+
+// newTableFile reads a table file's offsets from its offset index, if
+// the datastore keeps them and the index is current, and otherwise from
+// the table file itself.  In recovery mode, it also returns the lines
+// of the table file that had to be skipped.
+func (dsk *Disk) newTableFile(tableName string, filePtr *os.File) (*tableFile, []QuarantinedLine, error) {
+	if dsk.offsetIndex {
+		tableFile, err := dsk.loadOffsetIndex(tableName, filePtr)
 		if err != nil {
+			return nil, nil, err
+		}
+
+		if tableFile != nil {
+			return tableFile, nil, nil
+		}
+	}
+
+	var skipped []QuarantinedLine
+	var skip func(line []byte, err *dberr.CorruptError)
+
+	if dsk.recovery {
+		skip = func(line []byte, err *dberr.CorruptError) {
+			skipped = append(skipped, QuarantinedLine{Table: tableName, Offset: err.Offset, Line: line, Err: err})
+		}
+	}
+
+	tableFile, err := newTableFile(tableName, filePtr, dsk.codecFor(tableName), skip)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tableFile, skipped, nil
+}
+
+// loadSeq reads a table's id sequence from its file, if it has one.  The
+// sequence is never less than the greatest id in the table, which also
+// covers tables written before sequences were saved, and sequence files
+// that can't be parsed, which are ignored.
+func (dsk *Disk) loadSeq(tableName string) error {
+	tableFile := dsk.tableFiles[tableName]
+	seq := tableFile.getLastID()
+
+	b, err := os.ReadFile(dsk.getSeqPath(tableName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if err == nil {
+		saved, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err == nil && saved > seq {
+			seq = saved
+		}
+	}
+
+	tableFile.seq = seq
+
+	return nil
+}
+
+// writeSeq saves a table's id sequence.  It is written to a temporary
+// file first, which is synced and renamed into place, so a crash never
+// leaves the sequence file half written, and, unless the table's sync
+// policy is SyncNever, the new sequence is on disk before the id is
+// handed out.
+func (dsk *Disk) writeSeq(tableName string, seq int) error {
+	p := dsk.getSeqPath(tableName)
+	tmpPath := p + ".tmp"
+
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	durable := dsk.syncFor(tableName).mode != syncNever
+
+	if _, err := f.WriteString(strconv.Itoa(seq) + "\n"); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if durable {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			os.Remove(tmpPath)
 			return err
 		}
+	}
 
-		dsk.tableFiles[tableName] = tableFile
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, p); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if durable {
+		return syncDir(dsk.path)
 	}
 
 	return nil
 }
 
-func (dsk Disk) openFile(tableName string, createIfNeeded bool) (*os.File, error) {
+func (dsk *Disk) openFile(tableName string, createIfNeeded bool) (*os.File, error) {
 	var osFlag int
 
 	if createIfNeeded {
 		osFlag = os.O_CREATE | os.O_RDWR
+	} else if dsk.lockMode == LockShared {
+		osFlag = os.O_RDONLY
 	} else {
 		osFlag = os.O_RDWR
 	}
@@ -344,12 +823,61 @@ func (dsk Disk) openFile(tableName string, createIfNeeded bool) (*os.File, error
 	return filePtr, nil
 }
 
+// syncDir syncs a directory, so a file renamed into it stays renamed.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
+
+// closeTableFile closes a table file as the datastore is closed, once
+// the operations under way on it are done.
+func (dsk *Disk) closeTableFile(tableName string, tableFile *tableFile) error {
+	tableFile.mu.Lock()
+	defer tableFile.mu.Unlock()
+
+	if tableFile.closed {
+		return nil
+	}
+
+	if dsk.compactOnClose != nil && dsk.lockMode != LockShared {
+		f, err := tableFile.fragmentation()
+		if err == nil && dsk.compactOnClose.crossed(f) {
+			_, err = dsk.compactFile(tableName, tableFile)
+		}
+
+		if err != nil {
+			tableFile.close()
+			return err
+		}
+	}
+
+	idx := tableFile.newOffsetIndex()
+
+	if err := tableFile.close(); err != nil {
+		return err
+	}
+
+	if dsk.offsetIndex && dsk.lockMode != LockShared {
+		return dsk.writeOffsetIndex(tableName, idx)
+	}
+
+	return nil
+}
+
 func (dsk *Disk) closeTable(tableName string) error {
-	tableFile, ok := dsk.tableFiles[tableName]
-	if !ok {
-		return dberr.ErrNoTable
+	tableFile, err := dsk.getTableFile(tableName)
+	if err != nil {
+		return err
 	}
 
+	tableFile.mu.Lock()
+	defer tableFile.mu.Unlock()
+
 	if err := tableFile.close(); err != nil {
 		return err
 	}
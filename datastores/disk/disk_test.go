@@ -5,6 +5,7 @@ import (
 	"os"
 	"reflect"
 	"sort"
+	"strconv"
 	"testing"
 
 	"github.com/jameycribbs/hare/dberr"
@@ -42,13 +43,36 @@ func TestNewCloseDiskTests(t *testing.T) {
 				t.Errorf("want %v; got %v", wantOffsets, gotOffsets)
 			}
 		},
+		func(t *testing.T) {
+			//New (corrupt record)...
+
+			testAppendLines(t, "not a record\n")
+
+			_, gotErr := New("./testdata", ".json")
+
+			wantErr := dberr.ErrCorrupt
+			if !errors.Is(gotErr, wantErr) {
+				t.Fatalf("want %v; got %v", wantErr, gotErr)
+			}
+
+			var corruptErr *dberr.CorruptError
+			if !errors.As(gotErr, &corruptErr) {
+				t.Fatalf("want %T; got %T", corruptErr, gotErr)
+			}
+
+			want := int64(284)
+			got := corruptErr.Offset
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
 		func(t *testing.T) {
 			//Close...
 
 			dsk := newTestDisk(t)
 			dsk.Close()
 
-			wantErr := dberr.ErrNoTable
+			wantErr := dberr.ErrClosed
 			_, gotErr := dsk.ReadRec("contacts", 3)
 
 			if !errors.Is(gotErr, wantErr) {
@@ -61,6 +85,26 @@ func TestNewCloseDiskTests(t *testing.T) {
 				t.Errorf("want %v; got %v", nil, got)
 			}
 		},
+		func(t *testing.T) {
+			//Close (twice)...
+
+			dsk := newTestDisk(t)
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Errorf("want %v; got %v", nil, err)
+			}
+
+			wantErr := dberr.ErrClosed
+			gotErr := dsk.CreateTable("newtable")
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
 	}
 
 	runTestFns(t, tests)
@@ -294,6 +338,147 @@ func TestInsertRecDiskTests(t *testing.T) {
 				t.Errorf("want %v; got %v", want, got)
 			}
 		},
+		func(t *testing.T) {
+			//InsertRec and UpdateRec (BadRecord error)...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			wantErr := dberr.ErrBadRecord
+
+			for _, rec := range []string{"", "XYZ", "\nabc", "abc\ndef"} {
+				if gotErr := dsk.InsertRec("contacts", 5, []byte(rec)); !errors.Is(gotErr, wantErr) {
+					t.Errorf("want %v; got %v", wantErr, gotErr)
+				}
+
+				if gotErr := dsk.UpdateRec("contacts", 3, []byte(rec)); !errors.Is(gotErr, wantErr) {
+					t.Errorf("want %v; got %v", wantErr, gotErr)
+				}
+			}
+
+			fi, err := os.Stat("./testdata/contacts.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := int64(284); want != fi.Size() {
+				t.Errorf("want %v; got %v", want, fi.Size())
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
+func TestNextIDDiskTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//NextID (survives delete and reopen)...
+
+			dsk := newTestDisk(t)
+
+			id, err := dsk.NextID("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.InsertRec("contacts", id, []byte(`{"id":5,"first_name":"Rex","last_name":"Stout","age":77}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.DeleteRec("contacts", id); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk.Close()
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			want := 6
+			got, err := dsk.NextID("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//NextID (survives compaction)...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			for i := 0; i < 3; i++ {
+				if _, err := dsk.NextID("contacts"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := dsk.CompactTable("contacts"); err != nil {
+				t.Fatal(err)
+			}
+
+			want := 8
+			got, err := dsk.NextID("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//NextID (NoTable error)...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			wantErr := dberr.ErrNoTable
+			_, gotErr := dsk.NextID("nonexistent")
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
+		func(t *testing.T) {
+			//NextID (empty sequence file)...
+
+			// A crash part way through writing a sequence file used to
+			// leave it empty.
+			if err := os.WriteFile("./testdata/contacts.seq", nil, 0660); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			want := 5
+			got, err := dsk.NextID("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			b, err := os.ReadFile("./testdata/contacts.seq")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := "5\n"; want != string(b) {
+				t.Errorf("want %v; got %v", want, string(b))
+			}
+
+			if _, err := os.Stat("./testdata/contacts.seq.tmp"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("want %v; got %v", os.ErrNotExist, err)
+			}
+		},
 	}
 
 	runTestFns(t, tests)
@@ -384,6 +569,69 @@ func TestRemoveTableDiskTests(t *testing.T) {
 	runTestFns(t, tests)
 }
 
+func TestScanDiskTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//Scan...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			var got []string
+			err := dsk.Scan("contacts", func(id int, rec []byte) error {
+				got = append(got, strconv.Itoa(id)+":"+string(rec))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{
+				`1:{"id":1,"first_name":"John","last_name":"Doe","age":37}`,
+				`2:{"id":2,"first_name":"Abe","last_name":"Lincoln","age":52}`,
+				`3:{"id":3,"first_name":"Bill","last_name":"Shakespeare","age":18}`,
+				`4:{"id":4,"first_name":"Helen","last_name":"Keller","age":25}`,
+			}
+
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//Scan (NoTable error)...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			wantErr := dberr.ErrNoTable
+			gotErr := dsk.Scan("nonexistent", func(id int, rec []byte) error { return nil })
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
+		func(t *testing.T) {
+			//Snapshot...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			got, err := dsk.Snapshot("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := "{\"id\":3,\"first_name\":\"Bill\",\"last_name\":\"Shakespeare\",\"age\":18}"
+
+			if len(got) != 4 || want != string(got[3]) {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
 func TestTableExistsDiskTests(t *testing.T) {
 	var tests = []func(t *testing.T){
 		func(t *testing.T) {
@@ -495,6 +743,59 @@ func TestCompactTableTests(t *testing.T) {
 				t.Errorf("want %v; got %v", want, got)
 			}
 		},
+		func(t *testing.T) {
+			//CompactTableReport...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			if err := dsk.UpdateRec("contacts", 1, []byte(`{"id":1,"first_name":"John","last_name":"Doe","age":38}`)); err != nil {
+				t.Fatal(err)
+			}
+			if err := dsk.DeleteRec("contacts", 2); err != nil {
+				t.Fatal(err)
+			}
+
+			gotReclaimed, err := dsk.CompactTableReport("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantReclaimed := int64(45 + 59)
+			if wantReclaimed != gotReclaimed {
+				t.Errorf("want %v; got %v", wantReclaimed, gotReclaimed)
+			}
+
+			b, err := os.ReadFile("./testdata/contacts.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := `{"id":1,"first_name":"John","last_name":"Doe","age":38}` + "\n" +
+				`{"id":3,"first_name":"Bill","last_name":"Shakespeare","age":18}` + "\n" +
+				`{"id":4,"first_name":"Helen","last_name":"Keller","age":25}` + "\n"
+			if want != string(b) {
+				t.Errorf("want %v; got %v", want, string(b))
+			}
+
+			rec, err := dsk.ReadRec("contacts", 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantRec := `{"id":4,"first_name":"Helen","last_name":"Keller","age":25}` + "\n"
+			if wantRec != string(rec) {
+				t.Errorf("want %v; got %v", wantRec, string(rec))
+			}
+
+			if n := len(dsk.tableFiles["contacts"].free.slots); n != 0 {
+				t.Errorf("want %v; got %v", 0, n)
+			}
+
+			if _, err := os.Stat("./testdata/contacts.json.tmp"); !os.IsNotExist(err) {
+				t.Errorf("want %v; got %v", "no temporary file", err)
+			}
+		},
 	}
 
 	runTestFns(t, tests)
@@ -0,0 +1,69 @@
+package disk
+
+import "sort"
+
+// freeSlot is a dummy line in a table file that a record can be written
+// over.  Size is the length of the line without its newline, which is
+// the longest record that fits.
+type freeSlot struct {
+	offset int64
+	size   int
+}
+
+// freeList holds the dummy lines of a table file, ordered by size and
+// then by offset, so the smallest line a record fits on is found with a
+// binary search.  Bytes is the total length of the lines, newlines
+// included.
+type freeList struct {
+	slots []freeSlot
+	bytes int64
+}
+
+// add records a dummy line.
+func (f *freeList) add(offset int64, size int) {
+	slot := freeSlot{offset: offset, size: size}
+
+	i := f.search(slot)
+
+	f.slots = append(f.slots, freeSlot{})
+	copy(f.slots[i+1:], f.slots[i:])
+	f.slots[i] = slot
+
+	f.bytes += int64(size) + 1
+}
+
+// fit returns the smallest dummy line that a record of the given length
+// fits on, or false if there is none.
+func (f *freeList) fit(size int) (freeSlot, bool) {
+	i := f.search(freeSlot{size: size})
+	if i == len(f.slots) {
+		return freeSlot{}, false
+	}
+
+	return f.slots[i], true
+}
+
+// remove forgets a dummy line that is no longer free.
+func (f *freeList) remove(slot freeSlot) {
+	i := f.search(slot)
+	if i == len(f.slots) || f.slots[i] != slot {
+		return
+	}
+
+	f.slots = append(f.slots[:i], f.slots[i+1:]...)
+
+	f.bytes -= int64(slot.size) + 1
+}
+
+// search returns the index of the first slot that is not less than
+// slot.
+func (f *freeList) search(slot freeSlot) int {
+	return sort.Search(len(f.slots), func(i int) bool {
+		s := f.slots[i]
+		if s.size != slot.size {
+			return s.size > slot.size
+		}
+
+		return s.offset >= slot.offset
+	})
+}
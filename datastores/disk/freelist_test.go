@@ -0,0 +1,102 @@
+package disk
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestFreeListTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//add, fit, remove...
+
+			var f freeList
+
+			f.add(300, 20)
+			f.add(100, 50)
+			f.add(200, 20)
+			f.add(0, 5)
+
+			tests := []struct {
+				size int
+				want freeSlot
+				ok   bool
+			}{
+				{1, freeSlot{offset: 0, size: 5}, true},
+				{6, freeSlot{offset: 200, size: 20}, true},
+				{20, freeSlot{offset: 200, size: 20}, true},
+				{21, freeSlot{offset: 100, size: 50}, true},
+				{51, freeSlot{}, false},
+			}
+
+			for _, tt := range tests {
+				got, ok := f.fit(tt.size)
+				if tt.want != got || tt.ok != ok {
+					t.Errorf("want %v %v; got %v %v", tt.want, tt.ok, got, ok)
+				}
+			}
+
+			f.remove(freeSlot{offset: 200, size: 20})
+
+			want := freeSlot{offset: 300, size: 20}
+			got, _ := f.fit(6)
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//free list kept current by writes...
+
+			dsk := newTestDisk(t)
+			tf := dsk.tableFiles["contacts"]
+
+			for id := 5; id < 25; id++ {
+				rec := fmt.Sprintf(`{"id":%d,"first_name":"%s","last_name":"Doe","age":%d}`, id, "Jane", id)
+				if err := dsk.InsertRec("contacts", id, []byte(rec)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for id := 5; id < 25; id += 3 {
+				if err := dsk.DeleteRec("contacts", id); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for id := 6; id < 25; id += 3 {
+				rec := fmt.Sprintf(`{"id":%d,"first_name":"%s","last_name":"Doe","age":%d}`, id, "J", id)
+				if err := dsk.UpdateRec("contacts", id, []byte(rec)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for id := 7; id < 25; id += 3 {
+				rec := fmt.Sprintf(`{"id":%d,"first_name":"%s","last_name":"Doe","age":%d}`, id, "Jacqueline-Josephine", id)
+				if err := dsk.UpdateRec("contacts", id, []byte(rec)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for id := 25; id < 30; id++ {
+				rec := fmt.Sprintf(`{"id":%d,"first_name":"%s","last_name":"Doe","age":%d}`, id, "Jo", id)
+				if err := dsk.InsertRec("contacts", id, []byte(rec)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want := append([]freeSlot(nil), tf.free.slots...)
+
+			if err := tf.loadFreeList(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := tf.free.slots
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
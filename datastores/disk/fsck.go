@@ -0,0 +1,522 @@
+package disk
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jameycribbs/hare/codec"
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// ProblemKind is the kind of a Problem.
+type ProblemKind int
+
+const (
+	// ProblemInvalid is a line that can't be read as a record, such as a
+	// line of broken JSON or a record with no id.
+	ProblemInvalid ProblemKind = iota + 1
+	// ProblemTruncated is a last line with no newline, left by a write
+	// that never finished.  New won't open the table, unless it is in
+	// recovery mode, since the next record would be appended to it.
+	ProblemTruncated
+	// ProblemBadPadding is a dummy record that isn't all padding, so it
+	// may hide part of a record.
+	ProblemBadPadding
+	// ProblemDuplicate is a record whose id, or key, is found again
+	// further on in the table file.  The datastore reads the last one.
+	ProblemDuplicate
+	// ProblemIndexMismatch is a record that the table's offset index
+	// puts somewhere other than where the table file has it.
+	ProblemIndexMismatch
+	// ProblemUnrecovered is a write-ahead log holding changes that
+	// haven't been made to the table file, or a transaction log
+	// holding a batch that was never finished.
+	ProblemUnrecovered
+)
+
+// String returns a short description of the kind of problem.
+func (k ProblemKind) String() string {
+	switch k {
+	case ProblemInvalid:
+		return "invalid record"
+	case ProblemTruncated:
+		return "truncated line"
+	case ProblemBadPadding:
+		return "bad padding"
+	case ProblemDuplicate:
+		return "duplicate record"
+	case ProblemIndexMismatch:
+		return "offset index mismatch"
+	case ProblemUnrecovered:
+		return "unrecovered changes"
+	}
+
+	return "problem " + strconv.Itoa(int(k))
+}
+
+// Problem is something wrong with a table that Check found.
+type Problem struct {
+	// Table is the name of the table.
+	Table string
+	// Kind is the kind of problem.
+	Kind ProblemKind
+	// Offset is where the line starts in the table file, or -1 if the
+	// problem isn't with a line of it.
+	Offset int64
+	// ID is the record's id, and Key its key, for duplicate records and
+	// offset index mismatches.
+	ID  int
+	Key string
+	// Line is the line, without its newline.
+	Line []byte
+	// Err says what is wrong.
+	Err error
+}
+
+// String returns the problem, with the table, offset and record it
+// is about.
+func (p Problem) String() string {
+	var b strings.Builder
+
+	b.WriteString(p.Table)
+
+	if p.Offset >= 0 {
+		b.WriteString(" at offset " + strconv.FormatInt(p.Offset, 10))
+	}
+
+	if p.Key != "" {
+		b.WriteString(" record " + p.Key)
+	} else if p.ID != 0 {
+		b.WriteString(" record " + strconv.Itoa(p.ID))
+	}
+
+	return b.String() + ": " + p.Kind.String() + ": " + p.Err.Error()
+}
+
+// CheckReport is what Check or Repair found in a database directory.
+type CheckReport struct {
+	// Tables are the tables that were checked.
+	Tables []string
+	// Problems are the problems found, table by table.
+	Problems []Problem
+	// Repaired are the tables Repair changed.
+	Repaired []string
+}
+
+var (
+	errBadPadding  = errors.New("disk: dummy record isn't all padding")
+	errUnrecovered = errors.New("disk: write-ahead log holds changes to recover")
+	errUnfinished  = errors.New("disk: transaction log holds a batch to roll back")
+)
+
+// Check reads every table file in a database directory, the way New
+// does, and reports the problems it finds without changing anything.
+// opts are the Options the datastore is opened with, of which only the
+// codecs matter.  Check takes a shared lock on the directory, so it
+// returns dberr.ErrLocked while a Disk has it open for writing.
+func Check(path string, ext string, opts ...Option) (*CheckReport, error) {
+	dsk := newDisk(path, ext, opts)
+	dsk.lockMode = LockShared
+
+	if err := dsk.lock(); err != nil {
+		return nil, err
+	}
+	defer dsk.unlock()
+
+	return dsk.check(false)
+}
+
+// Repair checks a database directory like Check, and then mends each
+// table with problems.  It rolls back a batch left in the transaction
+// log, makes the changes left in the table's write-ahead log, and
+// rewrites the table file with only the last
+// version of each record, in order.  Every other line, apart from dummy
+// records, is first appended to the table's ".quarantine" file, the way
+// WithRecovery does it, so nothing is lost.  An offset index that no
+// longer matches the table file is removed.  Repair takes an exclusive
+// lock on the directory.
+func Repair(path string, ext string, opts ...Option) (*CheckReport, error) {
+	dsk := newDisk(path, ext, opts)
+	dsk.lockMode = LockExclusive
+
+	if err := dsk.lock(); err != nil {
+		return nil, err
+	}
+	defer dsk.unlock()
+
+	return dsk.check(true)
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+func (dsk *Disk) check(repair bool) (*CheckReport, error) {
+	tableNames, err := dsk.getTableNames()
+	if err != nil {
+		return nil, err
+	}
+
+	report := CheckReport{Tables: tableNames}
+
+	// A batch left in the transaction log is rolled back first, as New
+	// does, since the log points into the table files as they are.
+	rolledBack, err := dsk.checkTxLog(repair)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tableName := range rolledBack {
+		report.Problems = append(report.Problems, Problem{Table: tableName, Kind: ProblemUnrecovered, Offset: -1, Err: errUnfinished})
+	}
+
+	for _, tableName := range tableNames {
+		problems, repaired, err := dsk.checkTable(tableName, repair)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Problems = append(report.Problems, problems...)
+
+		if repaired || (repair && slices.Contains(rolledBack, tableName)) {
+			report.Repaired = append(report.Repaired, tableName)
+		}
+	}
+
+	return &report, nil
+}
+
+// checkTxLog returns the tables with changes in a batch left in the
+// transaction log, and if repair is set, rolls the batch back.
+func (dsk *Disk) checkTxLog(repair bool) ([]string, error) {
+	flag := os.O_RDONLY
+	if repair {
+		flag = os.O_RDWR
+	}
+
+	filePtr, err := os.OpenFile(filepath.Join(dsk.path, txLogFileName), flag, 0660)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer filePtr.Close()
+
+	l := &txLog{ptr: filePtr}
+
+	if repair {
+		return dsk.rollBack(l)
+	}
+
+	undos, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var tableNames []string
+
+	for _, undo := range undos {
+		if !slices.Contains(tableNames, undo.tableName) {
+			tableNames = append(tableNames, undo.tableName)
+		}
+	}
+
+	return tableNames, nil
+}
+
+// checkTable checks a table and, if repair is set and it has problems,
+// mends it.  It reports whether the table was changed.
+func (dsk *Disk) checkTable(tableName string, repair bool) ([]Problem, bool, error) {
+	var problems []Problem
+
+	flag := os.O_RDONLY
+	if repair {
+		flag = os.O_RDWR
+	}
+
+	filePtr, err := os.OpenFile(filepath.Join(dsk.path, tableName+dsk.ext), flag, 0660)
+	if err != nil {
+		return nil, false, err
+	}
+	defer filePtr.Close()
+
+	fi, err := os.Stat(dsk.getWALPath(tableName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, false, err
+	}
+
+	unrecovered := err == nil && fi.Size() > 0
+
+	if unrecovered {
+		problems = append(problems, Problem{Table: tableName, Kind: ProblemUnrecovered, Offset: -1, Err: errUnrecovered})
+
+		if repair {
+			if err := dsk.replayWAL(tableName, filePtr); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+
+	tableFile, lineProblems, err := scanTableFile(tableName, filePtr, dsk.codecFor(tableName))
+	if err != nil {
+		return nil, false, err
+	}
+
+	idxProblems, err := dsk.checkOffsetIndex(tableName, tableFile)
+	if err != nil {
+		return nil, false, err
+	}
+
+	problems = append(problems, lineProblems...)
+	problems = append(problems, idxProblems...)
+
+	if !repair || len(problems) == 0 {
+		return problems, false, nil
+	}
+
+	if len(lineProblems) > 0 {
+		lines := make([]QuarantinedLine, len(lineProblems))
+
+		for i, p := range lineProblems {
+			lines[i] = QuarantinedLine{
+				Table:  tableName,
+				Offset: p.Offset,
+				Line:   p.Line,
+				Err:    &dberr.CorruptError{Table: tableName, Offset: p.Offset, Err: p.Err},
+			}
+		}
+
+		if err := dsk.writeQuarantine(tableName, lines); err != nil {
+			return nil, false, err
+		}
+
+		if err := dsk.rewriteTableFile(tableName, tableFile); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if len(lineProblems) > 0 || len(idxProblems) > 0 {
+		if err := os.Remove(dsk.getIdxPath(tableName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, false, err
+		}
+	}
+
+	return problems, true, nil
+}
+
+// replayWAL makes the changes left in a table's write-ahead log to the
+// table file, which empties the log.
+func (dsk *Disk) replayWAL(tableName string, filePtr *os.File) error {
+	w, err := openWAL(dsk.getWALPath(tableName), filePtr, SyncAlways)
+	if err != nil {
+		return err
+	}
+
+	if err := w.replay(); err != nil {
+		w.close()
+		return err
+	}
+
+	return w.close()
+}
+
+// scanTableFile reads every line of a table file, with the same rules
+// as newTableFile, and returns the table file, holding where the last
+// version of each record is, and the problems with its lines, in order.
+func scanTableFile(tableName string, filePtr *os.File, c codec.Codec) (*tableFile, []Problem, error) {
+	var problems []Problem
+	var offset int64
+
+	tableFile := tableFile{
+		ptr: filePtr,
+	}
+	tableFile.offsets = make(map[int]int64)
+	tableFile.keys = make(map[string]int64)
+
+	duplicate := func(prevOffset int64, p Problem) error {
+		rec, err := tableFile.readRecAt(prevOffset)
+		if err != nil {
+			return err
+		}
+
+		p.Table = tableName
+		p.Kind = ProblemDuplicate
+		p.Offset = prevOffset
+		p.Line = rec[:len(rec)-1]
+		p.Err = fmt.Errorf("disk: a later version is at offset %d", offset)
+		problems = append(problems, p)
+
+		return nil
+	}
+
+	r := tableFile.reader(0)
+
+	for {
+		rec, err := r.ReadBytes('\n')
+
+		if err == io.EOF {
+			if len(rec) > 0 {
+				problems = append(problems, Problem{Table: tableName, Kind: ProblemTruncated, Offset: offset, Line: rec, Err: errTruncated})
+			}
+			break
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		line := rec[:len(rec)-1]
+
+		// A dummy record should be just what padRec writes.
+		if isDummy(rec) {
+			if !bytes.Equal(line, padRec(len(rec))[1:]) {
+				problems = append(problems, Problem{Table: tableName, Kind: ProblemBadPadding, Offset: offset, Line: line, Err: errBadPadding})
+			}
+
+			offset += int64(len(rec))
+			continue
+		}
+
+		id, key, keyed, err := readRecordRef(c, rec)
+
+		switch {
+		case err != nil:
+			problems = append(problems, Problem{Table: tableName, Kind: ProblemInvalid, Offset: offset, Line: line, Err: err})
+		case keyed:
+			if prevOffset, ok := tableFile.keys[key]; ok {
+				if err := duplicate(prevOffset, Problem{Key: key}); err != nil {
+					return nil, nil, err
+				}
+			}
+
+			tableFile.keys[key] = offset
+		default:
+			if prevOffset, ok := tableFile.offsets[id]; ok {
+				if err := duplicate(prevOffset, Problem{ID: id}); err != nil {
+					return nil, nil, err
+				}
+			}
+
+			tableFile.offsets[id] = offset
+		}
+
+		offset += int64(len(rec))
+	}
+
+	// Duplicates are found after the lines they are about.
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Offset < problems[j].Offset
+	})
+
+	return &tableFile, problems, nil
+}
+
+// checkOffsetIndex compares a table's offset index, if it has one that
+// New would use, with where the records are in the table file.
+func (dsk *Disk) checkOffsetIndex(tableName string, tableFile *tableFile) ([]Problem, error) {
+	idx, err := readOffsetIndex(dsk.getIdxPath(tableName), tableFile.ptr)
+	if err != nil || idx == nil {
+		return nil, err
+	}
+
+	var problems []Problem
+
+	mismatch := func(p Problem, offset int64, inFile bool, idxOffset int64, inIdx bool) {
+		if inFile && inIdx && offset == idxOffset {
+			return
+		}
+
+		p.Table = tableName
+		p.Kind = ProblemIndexMismatch
+		p.Offset = -1
+
+		if inFile {
+			p.Offset = offset
+		}
+
+		if inIdx {
+			p.Err = fmt.Errorf("disk: offset index has it at offset %d", idxOffset)
+		} else {
+			p.Err = errors.New("disk: offset index doesn't have it")
+		}
+
+		problems = append(problems, p)
+	}
+
+	ids := make(map[int]bool)
+	for id := range tableFile.offsets {
+		ids[id] = true
+	}
+	for id := range idx.Offsets {
+		ids[id] = true
+	}
+
+	sortedIDs := make([]int, 0, len(ids))
+	for id := range ids {
+		sortedIDs = append(sortedIDs, id)
+	}
+	sort.Ints(sortedIDs)
+
+	for _, id := range sortedIDs {
+		offset, inFile := tableFile.offsets[id]
+		idxOffset, inIdx := idx.Offsets[id]
+		mismatch(Problem{ID: id}, offset, inFile, idxOffset, inIdx)
+	}
+
+	keys := make(map[string]bool)
+	for key := range tableFile.keys {
+		keys[key] = true
+	}
+	for key := range idx.Keys {
+		keys[key] = true
+	}
+
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	for _, key := range sortedKeys {
+		offset, inFile := tableFile.keys[key]
+		idxOffset, inIdx := idx.Keys[key]
+		mismatch(Problem{Key: key}, offset, inFile, idxOffset, inIdx)
+	}
+
+	return problems, nil
+}
+
+// rewriteTableFile writes the records a table file holds to a new file,
+// which is synced and renamed over the table file.
+func (dsk *Disk) rewriteTableFile(tableName string, tableFile *tableFile) error {
+	tablePath := filepath.Join(dsk.path, tableName+dsk.ext)
+	tmpPath := tablePath + ".tmp"
+
+	c, err := tableFile.copyLive(tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := c.ptr.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, tablePath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return syncDir(dsk.path)
+}
@@ -0,0 +1,317 @@
+package disk
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestFsckTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//Check (no problems)...
+
+			report, err := Check("./testdata", ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := []string{"contacts"}; !reflect.DeepEqual(want, report.Tables) {
+				t.Errorf("want %v; got %v", want, report.Tables)
+			}
+
+			if len(report.Problems) != 0 {
+				t.Errorf("want %v; got %v", 0, report.Problems)
+			}
+		},
+		func(t *testing.T) {
+			//Check (bad lines)...
+
+			testAppendFsckLines(t)
+
+			report, err := Check("./testdata", ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := []struct {
+				kind   ProblemKind
+				offset int64
+				id     int
+			}{
+				{ProblemDuplicate, 101, 2},
+				{ProblemInvalid, 343, 0},
+				{ProblemBadPadding, 356, 0},
+				{ProblemTruncated, 365, 0},
+			}
+
+			if len(report.Problems) != len(want) {
+				t.Fatalf("want %v; got %v", len(want), report.Problems)
+			}
+
+			for i, p := range report.Problems {
+				if p.Table != "contacts" || p.Kind != want[i].kind || p.Offset != want[i].offset || p.ID != want[i].id {
+					t.Errorf("want %v %v %v; got %v %v %v", want[i].kind, want[i].offset, want[i].id, p.Kind, p.Offset, p.ID)
+				}
+			}
+
+			wantString := "contacts at offset 101 record 2: duplicate record: disk: a later version is at offset 284"
+			if got := report.Problems[0].String(); wantString != got {
+				t.Errorf("want %v; got %v", wantString, got)
+			}
+
+			if len(report.Repaired) != 0 {
+				t.Errorf("want %v; got %v", 0, report.Repaired)
+			}
+
+			if _, err := os.Stat("./testdata/contacts.quarantine"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("want %v; got %v", os.ErrNotExist, err)
+			}
+		},
+		func(t *testing.T) {
+			//Repair (bad lines)...
+
+			testAppendFsckLines(t)
+
+			report, err := Repair("./testdata", ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(report.Problems) != 4 {
+				t.Errorf("want %v; got %v", 4, report.Problems)
+			}
+
+			if want := []string{"contacts"}; !reflect.DeepEqual(want, report.Repaired) {
+				t.Errorf("want %v; got %v", want, report.Repaired)
+			}
+
+			b, err := os.ReadFile("./testdata/contacts.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantTable := strings.Join([]string{
+				`{"id":1,"first_name":"John","last_name":"Doe","age":37}`,
+				`{"id":3,"first_name":"Bill","last_name":"Shakespeare","age":18}`,
+				`{"id":4,"first_name":"Helen","last_name":"Keller","age":25}`,
+				`{"id":2,"first_name":"Abe","last_name":"Lincoln","age":53}`,
+			}, "\n") + "\n"
+			if wantTable != string(b) {
+				t.Errorf("want %v; got %v", wantTable, string(b))
+			}
+
+			b, err = os.ReadFile("./testdata/contacts.quarantine")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantQuarantine := strings.Join([]string{
+				`101	{"id":2,"first_name":"Abe","last_name":"Lincoln","age":52}`,
+				"343\tnot a record",
+				"356\tXXXXoops",
+				`365	{"id":9`,
+			}, "\n") + "\n"
+			if wantQuarantine != string(b) {
+				t.Errorf("want %v; got %v", wantQuarantine, string(b))
+			}
+
+			report, err = Check("./testdata", ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(report.Problems) != 0 {
+				t.Errorf("want %v; got %v", 0, report.Problems)
+			}
+		},
+		func(t *testing.T) {
+			//Check (offset index mismatch)...
+
+			dsk := newTestDisk(t, WithOffsetIndex())
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			fi, err := os.Stat("./testdata/contacts.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Change id 3 to id 7, leaving the size and modification
+			// time alone, so the index still looks current.
+			f, err := os.OpenFile("./testdata/contacts.json", os.O_WRONLY, 0660)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := f.WriteAt([]byte("7"), 166); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			if err := os.Chtimes("./testdata/contacts.json", fi.ModTime(), fi.ModTime()); err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := Check("./testdata", ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := []Problem{
+				{Table: "contacts", Kind: ProblemIndexMismatch, Offset: -1, ID: 3},
+				{Table: "contacts", Kind: ProblemIndexMismatch, Offset: 160, ID: 7},
+			}
+
+			if len(report.Problems) != len(want) {
+				t.Fatalf("want %v; got %v", len(want), report.Problems)
+			}
+
+			for i, p := range report.Problems {
+				p.Err = nil
+				if !reflect.DeepEqual(want[i], p) {
+					t.Errorf("want %v; got %v", want[i], p)
+				}
+			}
+
+			report, err = Repair("./testdata", ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := []string{"contacts"}; !reflect.DeepEqual(want, report.Repaired) {
+				t.Errorf("want %v; got %v", want, report.Repaired)
+			}
+
+			if _, err := os.Stat("./testdata/contacts.idx"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("want %v; got %v", os.ErrNotExist, err)
+			}
+		},
+		func(t *testing.T) {
+			//Repair (unrecovered changes)...
+
+			entry := encodeWALEntry([]walWrite{{offset: 0, data: []byte(strings.Repeat("X", 55))}})
+			if err := os.WriteFile("./testdata/contacts.wal", entry, 0660); err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := Check("./testdata", ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(report.Problems) != 1 || report.Problems[0].Kind != ProblemUnrecovered {
+				t.Fatalf("want %v; got %v", ProblemUnrecovered, report.Problems)
+			}
+
+			if _, err := Repair("./testdata", ".json"); err != nil {
+				t.Fatal(err)
+			}
+
+			report, err = Check("./testdata", ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(report.Problems) != 0 {
+				t.Errorf("want %v; got %v", 0, report.Problems)
+			}
+
+			dsk := newTestDisk(t)
+
+			if _, err := dsk.ReadRec("contacts", 1); !errors.Is(err, dberr.ErrNoRecord) {
+				t.Errorf("want %v; got %v", dberr.ErrNoRecord, err)
+			}
+		},
+		func(t *testing.T) {
+			//Repair (unfinished batch)...
+
+			entry := encodeTxEntry(txUndo{tableName: "contacts", size: 284, writes: []walWrite{{offset: 0, data: []byte(`{"id":1,"first_name":"John","last_name":"Doe","age":37}`)}}})
+
+			// The batch deleted record 1 and appended a record.
+			f, err := os.OpenFile("./testdata/contacts.json", os.O_WRONLY, 0660)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := f.WriteAt([]byte(strings.Repeat("X", 55)), 0); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			testAppendLines(t, `{"id":5,"first_name":"Rex","last_name":"Stout","age":77}`+"\n")
+
+			if err := os.WriteFile("./testdata/"+txLogFileName, entry, 0660); err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := Check("./testdata", ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(report.Problems) != 1 || report.Problems[0].Kind != ProblemUnrecovered || !errors.Is(report.Problems[0].Err, errUnfinished) {
+				t.Fatalf("want %v; got %v", ProblemUnrecovered, report.Problems)
+			}
+
+			report, err = Repair("./testdata", ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := []string{"contacts"}; !reflect.DeepEqual(want, report.Repaired) {
+				t.Errorf("want %v; got %v", want, report.Repaired)
+			}
+
+			want, err := os.ReadFile("./testdata/contacts.bak")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile("./testdata/contacts.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(want) != string(got) {
+				t.Errorf("want %v; got %v", string(want), string(got))
+			}
+
+			report, err = Check("./testdata", ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(report.Problems) != 0 {
+				t.Errorf("want %v; got %v", 0, report.Problems)
+			}
+		},
+		func(t *testing.T) {
+			//Check (locked)...
+
+			newTestDisk(t)
+
+			if _, err := Check("./testdata", ".json"); !errors.Is(err, dberr.ErrLocked) {
+				t.Errorf("want %v; got %v", dberr.ErrLocked, err)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
+func testAppendFsckLines(t *testing.T) {
+	t.Helper()
+
+	testAppendLines(t,
+		`{"id":2,"first_name":"Abe","last_name":"Lincoln","age":53}`+"\n",
+		"not a record\n",
+		"XXXXoops\n",
+		`{"id":9`,
+	)
+}
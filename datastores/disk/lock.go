@@ -0,0 +1,93 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// lockFileName is the name of the file, in the database directory, that
+// a Disk takes its lock on.
+const lockFileName = "hare.lock"
+
+// LockMode says how a Disk shares its database directory with other
+// Disks, in this process or another.
+type LockMode int
+
+const (
+	// LockExclusive lets one Disk open the directory, to read and to
+	// write.  It is the default.
+	LockExclusive LockMode = iota
+	// LockShared lets any number of Disks open the directory, but only
+	// to read.  Every change returns dberr.ErrReadOnly.
+	LockShared
+)
+
+// WithLock takes a LockMode and returns an Option that sets how the
+// Disk locks its database directory.  New returns dberr.ErrLocked if
+// the directory is already locked in a way that conflicts with it.
+//
+// The lock is an advisory flock(2) lock on the directory's "hare.lock"
+// file, held until the Disk is closed.  Anything else that changes the
+// table files, like a standalone compaction script, should take an
+// exclusive lock on the same file.  On platforms without flock, no lock
+// is taken.
+func WithLock(mode LockMode) Option {
+	return func(dsk *Disk) {
+		dsk.lockMode = mode
+	}
+}
+
+// lock takes the lock on the database directory.
+func (dsk *Disk) lock() error {
+	p := filepath.Join(dsk.path, lockFileName)
+
+	flag := os.O_CREATE | os.O_RDWR
+	if dsk.lockMode == LockShared {
+		flag = os.O_CREATE | os.O_RDONLY
+	}
+
+	filePtr, err := os.OpenFile(p, flag, 0660)
+	if err != nil {
+		return err
+	}
+
+	if err := flock(filePtr, dsk.lockMode == LockShared); err != nil {
+		filePtr.Close()
+
+		if errors.Is(err, errWouldBlock) {
+			return fmt.Errorf("%w: %s", dberr.ErrLocked, dsk.path)
+		}
+
+		return err
+	}
+
+	dsk.lockPtr = filePtr
+
+	return nil
+}
+
+// unlock releases the lock on the database directory.
+func (dsk *Disk) unlock() error {
+	if dsk.lockPtr == nil {
+		return nil
+	}
+
+	err := dsk.lockPtr.Close()
+	dsk.lockPtr = nil
+
+	return err
+}
+
+// writable returns dberr.ErrReadOnly if the Disk was opened with a
+// shared lock.
+func (dsk *Disk) writable() error {
+	if dsk.lockMode == LockShared {
+		return dberr.ErrReadOnly
+	}
+
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package disk
+
+import (
+	"errors"
+	"os"
+)
+
+// errWouldBlock is returned by flock when the lock is already held.
+var errWouldBlock = errors.New("disk: lock is held")
+
+// flock takes no lock on platforms without flock(2).
+func flock(filePtr *os.File, shared bool) error {
+	return nil
+}
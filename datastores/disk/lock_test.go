@@ -0,0 +1,98 @@
+//go:build unix
+
+package disk
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestLockTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//New (Locked error)...
+
+			dsk := newTestDisk(t)
+
+			_, err := New("./testdata", ".json")
+			if !errors.Is(err, dberr.ErrLocked) {
+				t.Errorf("want %v; got %v", dberr.ErrLocked, err)
+			}
+
+			_, err = New("./testdata", ".json", WithLock(LockShared))
+			if !errors.Is(err, dberr.ErrLocked) {
+				t.Errorf("want %v; got %v", dberr.ErrLocked, err)
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk = newTestDisk(t)
+			dsk.Close()
+		},
+		func(t *testing.T) {
+			//LockShared...
+
+			readers := []*Disk{
+				newTestDisk(t, WithLock(LockShared)),
+				newTestDisk(t, WithLock(LockShared)),
+			}
+
+			_, err := New("./testdata", ".json")
+			if !errors.Is(err, dberr.ErrLocked) {
+				t.Errorf("want %v; got %v", dberr.ErrLocked, err)
+			}
+
+			for _, dsk := range readers {
+				if _, err := dsk.ReadRec("contacts", 3); err != nil {
+					t.Fatal(err)
+				}
+			}
+		},
+		func(t *testing.T) {
+			//LockShared (ReadOnly errors)...
+
+			dsk := newTestDisk(t, WithLock(LockShared))
+
+			rec := []byte(`{"id":5,"first_name":"Rex","last_name":"Stout","age":77}`)
+
+			errs := []error{
+				dsk.CreateTable("newtable"),
+				dsk.InsertRec("contacts", 5, rec),
+				dsk.UpdateRec("contacts", 3, rec),
+				dsk.DeleteRec("contacts", 3),
+				dsk.RemoveTable("contacts"),
+				dsk.CompactTable("contacts"),
+			}
+
+			_, err := dsk.NextID("contacts")
+			errs = append(errs, err)
+
+			for _, err := range errs {
+				if !errors.Is(err, dberr.ErrReadOnly) {
+					t.Errorf("want %v; got %v", dberr.ErrReadOnly, err)
+				}
+			}
+		},
+		func(t *testing.T) {
+			//LockShared (changes to recover)...
+
+			rec := "{\"id\":3,\"first_name\":\"Will\",\"last_name\":\"Shakespeare\",\"age\":18}\n"
+			testWriteWAL(t, encodeWALEntry([]walWrite{{offset: 160, data: []byte(rec)}}))
+
+			_, err := New("./testdata", ".json", WithLock(LockShared))
+			if !errors.Is(err, dberr.ErrReadOnly) {
+				t.Errorf("want %v; got %v", dberr.ErrReadOnly, err)
+			}
+
+			// The failed New released its lock.
+			dsk := newTestDisk(t)
+			dsk.Close()
+		},
+	}
+
+	runTestFns(t, tests)
+}
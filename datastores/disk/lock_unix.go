@@ -0,0 +1,22 @@
+//go:build unix
+
+package disk
+
+import (
+	"os"
+	"syscall"
+)
+
+// errWouldBlock is returned by flock when the lock is already held.
+var errWouldBlock error = syscall.EWOULDBLOCK
+
+// flock takes an exclusive, or shared, lock on a file without waiting
+// for it.  The lock is released when the file is closed.
+func flock(filePtr *os.File, shared bool) error {
+	how := syscall.LOCK_EX
+	if shared {
+		how = syscall.LOCK_SH
+	}
+
+	return syscall.Flock(int(filePtr.Fd()), how|syscall.LOCK_NB)
+}
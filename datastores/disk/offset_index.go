@@ -0,0 +1,184 @@
+package disk
+
+import (
+	"encoding/gob"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// idxExt is the extension of a table's offset index, which sits
+// alongside the table file.
+const idxExt = ".idx"
+
+// offsetIndexVersion is bumped whenever the layout of offsetIndex
+// changes, so older index files are rebuilt rather than misread.
+const offsetIndexVersion = 1
+
+// offsetIndex is what an offset index file holds: where every record
+// and dummy record of a table file is, and the size and modification
+// time the table file had when the index was written.
+type offsetIndex struct {
+	Version int
+	Size    int64
+	ModTime int64
+	Offsets map[int]int64
+	Keys    map[string]int64
+	Free    []offsetIndexSlot
+}
+
+type offsetIndexSlot struct {
+	Offset int64
+	Size   int
+}
+
+// WithOffsetIndex returns an Option that saves each table's record
+// offsets and free list to an index file, a ".idx" file next to the
+// table's file, when the datastore is closed.  The next time the table
+// is opened, the index file is read instead of the whole table file,
+// unless the table file's size or modification time no longer match, in
+// which case the index is rebuilt from the table file.  The index file
+// is removed once it has been read, so one left by a process that
+// didn't close the datastore is never used.
+func WithOffsetIndex() Option {
+	return func(dsk *Disk) {
+		dsk.offsetIndex = true
+	}
+}
+
+// newOffsetIndex returns the offset index of a table file.
+func (t *tableFile) newOffsetIndex() *offsetIndex {
+	idx := offsetIndex{
+		Version: offsetIndexVersion,
+		Offsets: make(map[int]int64, len(t.offsets)),
+		Keys:    make(map[string]int64, len(t.keys)),
+		Free:    make([]offsetIndexSlot, len(t.free.slots)),
+	}
+
+	for id, offset := range t.offsets {
+		idx.Offsets[id] = offset
+	}
+
+	for key, offset := range t.keys {
+		idx.Keys[key] = offset
+	}
+
+	for i, slot := range t.free.slots {
+		idx.Free[i] = offsetIndexSlot{Offset: slot.offset, Size: slot.size}
+	}
+
+	return &idx
+}
+
+// loadOffsetIndex reads a table's offset index file and returns the
+// table file it describes, or nil if there is no index file or it no
+// longer matches the table file.
+func (dsk *Disk) loadOffsetIndex(tableName string, filePtr *os.File) (*tableFile, error) {
+	p := dsk.getIdxPath(tableName)
+
+	idx, err := readOffsetIndex(p, filePtr)
+	if err != nil {
+		return nil, err
+	}
+
+	if dsk.lockMode != LockShared {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	if idx == nil {
+		return nil, nil
+	}
+
+	tableFile := tableFile{
+		ptr:     filePtr,
+		offsets: idx.Offsets,
+		keys:    idx.Keys,
+	}
+
+	if tableFile.offsets == nil {
+		tableFile.offsets = make(map[int]int64)
+	}
+
+	if tableFile.keys == nil {
+		tableFile.keys = make(map[string]int64)
+	}
+
+	for _, slot := range idx.Free {
+		tableFile.free.add(slot.Offset, slot.Size)
+	}
+
+	return &tableFile, nil
+}
+
+// readOffsetIndex reads an offset index file, and returns nil if there
+// is no index file, or it can't be decoded, or it no longer matches the
+// table file.
+func readOffsetIndex(p string, filePtr *os.File) (*offsetIndex, error) {
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var idx offsetIndex
+
+	// An index file that can't be decoded is rebuilt like a stale one.
+	if err := gob.NewDecoder(f).Decode(&idx); err != nil {
+		return nil, nil
+	}
+
+	fi, err := filePtr.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if idx.Version != offsetIndexVersion || idx.Size != fi.Size() || idx.ModTime != fi.ModTime().UnixNano() {
+		return nil, nil
+	}
+
+	return &idx, nil
+}
+
+// writeOffsetIndex writes a table's offset index file, stamped with the
+// table file's current size and modification time.  It is written to a
+// temporary file first and renamed into place.
+func (dsk *Disk) writeOffsetIndex(tableName string, idx *offsetIndex) error {
+	fi, err := os.Stat(filepath.Join(dsk.path, tableName+dsk.ext))
+	if err != nil {
+		return err
+	}
+
+	idx.Size = fi.Size()
+	idx.ModTime = fi.ModTime().UnixNano()
+
+	p := dsk.getIdxPath(tableName)
+	tmpPath := p + ".tmp"
+
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	if err := gob.NewEncoder(f).Encode(idx); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, p)
+}
+
+func (dsk *Disk) getIdxPath(tableName string) string {
+	return filepath.Join(dsk.path, tableName+idxExt)
+}
@@ -0,0 +1,133 @@
+package disk
+
+import (
+	"encoding/gob"
+	"errors"
+	"io/fs"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestOffsetIndexTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//Close writes the index, New reads it...
+
+			dsk := newTestDisk(t, WithOffsetIndex())
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Move record 3 in the index only, to show New uses it.
+			idx := testReadOffsetIndex(t)
+			idx.Offsets[3] = 0
+			testWriteOffsetIndex(t, idx)
+
+			dsk = newTestDisk(t, WithOffsetIndex())
+			defer dsk.Close()
+
+			want := int64(0)
+			got := dsk.tableFiles["contacts"].offsets[3]
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			if _, err := os.Stat("./testdata/contacts" + idxExt); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("want %v; got %v", fs.ErrNotExist, err)
+			}
+		},
+		func(t *testing.T) {
+			//stale index is rebuilt...
+
+			dsk := newTestDisk(t, WithOffsetIndex())
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.OpenFile("./testdata/contacts.json", os.O_APPEND|os.O_WRONLY, 0660)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.WriteString(`{"id":5,"first_name":"Rex","last_name":"Stout","age":77}` + "\n"); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			dsk = newTestDisk(t, WithOffsetIndex())
+			defer dsk.Close()
+
+			want := int64(284)
+			got, ok := dsk.tableFiles["contacts"].offsets[5]
+			if !ok || want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//index matches the table file after changes...
+
+			dsk := newTestDisk(t, WithOffsetIndex())
+
+			if err := dsk.InsertRec("contacts", 5, []byte(`{"id":5,"first_name":"Rex","last_name":"Stout","age":77}`)); err != nil {
+				t.Fatal(err)
+			}
+			if err := dsk.UpdateRec("contacts", 2, []byte(`{"id":2,"first_name":"Abe","last_name":"L","age":52}`)); err != nil {
+				t.Fatal(err)
+			}
+			if err := dsk.DeleteRec("contacts", 4); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			dsk = newTestDisk(t, WithOffsetIndex())
+			defer dsk.Close()
+
+			fromIndex := dsk.tableFiles["contacts"]
+
+			fromFile, err := newTableFile("contacts", fromIndex.ptr, dsk.codecFor("contacts"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(fromFile.offsets, fromIndex.offsets) {
+				t.Errorf("want %v; got %v", fromFile.offsets, fromIndex.offsets)
+			}
+
+			if !reflect.DeepEqual(fromFile.free, fromIndex.free) {
+				t.Errorf("want %v; got %v", fromFile.free, fromIndex.free)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
+func testReadOffsetIndex(t *testing.T) *offsetIndex {
+	f, err := os.Open("./testdata/contacts" + idxExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var idx offsetIndex
+	if err := gob.NewDecoder(f).Decode(&idx); err != nil {
+		t.Fatal(err)
+	}
+
+	return &idx
+}
+
+func testWriteOffsetIndex(t *testing.T, idx *offsetIndex) {
+	f, err := os.Create("./testdata/contacts" + idxExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := gob.NewEncoder(f).Encode(idx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,114 @@
+package disk
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// quarantineExt is the extension of the file that holds the lines
+// recovery mode has taken out of a table file, alongside the table file.
+const quarantineExt = ".quarantine"
+
+// QuarantinedLine is a line of a table file that recovery mode skipped
+// because it couldn't be read as a record.
+type QuarantinedLine struct {
+	// Table is the name of the table.
+	Table string
+	// Offset is where the line started in the table file.
+	Offset int64
+	// Line is the line, without its newline.
+	Line []byte
+	// Err is why the line couldn't be read.
+	Err *dberr.CorruptError
+}
+
+// WithRecovery returns an Option that makes New skip the lines of a
+// table file that can't be read as records, instead of failing.  Each
+// one is appended, after its offset and a tab, to a ".quarantine" file
+// next to the table's file, and then overwritten with a dummy record,
+// so the table opens cleanly from then on.  With a shared lock the
+// table file can't be changed, so the lines are only skipped.  Either
+// way, Quarantined returns them.
+func WithRecovery() Option {
+	return func(dsk *Disk) {
+		dsk.recovery = true
+	}
+}
+
+// Quarantined returns the lines that recovery mode skipped when the
+// datastore was opened, in the order they were found.
+func (dsk *Disk) Quarantined() []QuarantinedLine {
+	dsk.mu.RLock()
+	defer dsk.mu.RUnlock()
+
+	return append([]QuarantinedLine(nil), dsk.quarantined...)
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+// quarantine saves the lines skipped from a table file to its
+// quarantine file, which is synced, and only then overwrites them with
+// dummy records.
+func (dsk *Disk) quarantine(tableName string, tableFile *tableFile, lines []QuarantinedLine) error {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	dsk.quarantined = append(dsk.quarantined, lines...)
+
+	if dsk.lockMode == LockShared {
+		return nil
+	}
+
+	if err := dsk.writeQuarantine(tableName, lines); err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		if err := tableFile.overwriteRec(line.Offset, len(line.Line)+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeQuarantine appends lines to a table's quarantine file, each after
+// its offset and a tab, and syncs it.
+func (dsk *Disk) writeQuarantine(tableName string, lines []QuarantinedLine) error {
+	f, err := os.OpenFile(dsk.getQuarantinePath(tableName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0660)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+
+	for _, line := range lines {
+		w.WriteString(strconv.FormatInt(line.Offset, 10))
+		w.WriteByte('\t')
+		w.Write(line.Line)
+		w.WriteByte('\n')
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (dsk *Disk) getQuarantinePath(tableName string) string {
+	return filepath.Join(dsk.path, tableName+quarantineExt)
+}
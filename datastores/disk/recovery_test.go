@@ -0,0 +1,166 @@
+package disk
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestRecoveryTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//WithRecovery...
+
+			testAppendLines(t, "not a record\n", `{"first_name":"No","last_name":"Id"}`+"\n")
+
+			dsk, err := New("./testdata", ".json", WithRecovery())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dsk.Close()
+
+			got := dsk.Quarantined()
+
+			if len(got) != 2 {
+				t.Fatalf("want %v; got %v", 2, len(got))
+			}
+
+			wantOffsets := []int64{284, 297}
+			wantLines := []string{"not a record", `{"first_name":"No","last_name":"Id"}`}
+
+			for i, q := range got {
+				if q.Table != "contacts" || q.Offset != wantOffsets[i] || string(q.Line) != wantLines[i] {
+					t.Errorf("want %v %v %v; got %v %v %s", "contacts", wantOffsets[i], wantLines[i], q.Table, q.Offset, q.Line)
+				}
+
+				if !errors.Is(q.Err, dberr.ErrCorrupt) {
+					t.Errorf("want %v; got %v", dberr.ErrCorrupt, q.Err)
+				}
+			}
+
+			if _, err := dsk.ReadRec("contacts", 4); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := os.ReadFile("./testdata/contacts.quarantine")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantQuarantine := "284\tnot a record\n" + `297	{"first_name":"No","last_name":"Id"}` + "\n"
+			if wantQuarantine != string(b) {
+				t.Errorf("want %v; got %v", wantQuarantine, string(b))
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The lines have been overwritten, so the table now opens
+			// without recovery mode.
+			dsk, err = New("./testdata", ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dsk.Close()
+
+			f, err := dsk.Fragmentation("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := int64(45 + 13 + 37); want != f.DeadBytes {
+				t.Errorf("want %v; got %v", want, f.DeadBytes)
+			}
+		},
+		func(t *testing.T) {
+			//WithRecovery (shared lock)...
+
+			testAppendLines(t, "not a record\n")
+
+			dsk, err := New("./testdata", ".json", WithRecovery(), WithLock(LockShared))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dsk.Close()
+
+			got := dsk.Quarantined()
+
+			if len(got) != 1 || got[0].Offset != 284 {
+				t.Errorf("want %v; got %v", 284, got)
+			}
+
+			if _, err := os.Stat("./testdata/contacts.quarantine"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("want %v; got %v", os.ErrNotExist, err)
+			}
+
+			fi, err := os.Stat("./testdata/contacts.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := int64(297); want != fi.Size() {
+				t.Errorf("want %v; got %v", want, fi.Size())
+			}
+		},
+		func(t *testing.T) {
+			//New (truncated last line)...
+
+			testAppendLines(t, `{"id":5,"first_name":"Tru`)
+
+			_, err := New("./testdata", ".json")
+
+			var corruptErr *dberr.CorruptError
+			if !errors.As(err, &corruptErr) || corruptErr.Offset != 284 {
+				t.Fatalf("want %v; got %v", "corrupt record at offset 284", err)
+			}
+		},
+		func(t *testing.T) {
+			//WithRecovery (truncated last line)...
+
+			testAppendLines(t, `{"id":5,"first_name":"Tru`)
+
+			dsk, err := New("./testdata", ".json", WithRecovery())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dsk.Close()
+
+			got := dsk.Quarantined()
+
+			if len(got) != 1 || got[0].Offset != 284 || string(got[0].Line) != `{"id":5,"first_name":"Tru` {
+				t.Fatalf("want %v; got %v", 284, got)
+			}
+
+			rec := `{"id":6,"first_name":"Rex","last_name":"Stout","age":77}`
+			if err := dsk.InsertRec("contacts", 6, []byte(rec)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The fragment was padded into a dummy record, so the new
+			// record is on a line of its own.
+			dsk, err = New("./testdata", ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dsk.Close()
+
+			b, err := dsk.ReadRec("contacts", 6)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := rec + "\n"; want != string(b) {
+				t.Errorf("want %v; got %v", want, string(b))
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
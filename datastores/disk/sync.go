@@ -0,0 +1,96 @@
+package disk
+
+import (
+	"time"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+type syncMode int
+
+const (
+	syncAlways syncMode = iota
+	syncEvery
+	syncNever
+)
+
+// SyncPolicy controls how often changes to a table are synced to stable
+// storage.  Every change is written to the table's write-ahead log
+// before the table file, and the log is replayed when the table is next
+// opened, so a change is made in full or not at all if the process
+// dies.  SyncAlways and SyncEvery also sync the log entry before the
+// table file is written, so that holds after a power loss too; they
+// differ in how often the table file itself is synced.
+type SyncPolicy struct {
+	mode     syncMode
+	interval time.Duration
+	writes   int
+}
+
+// SyncAlways syncs every change before it returns.  It is the slowest
+// policy and the default.
+var SyncAlways = SyncPolicy{mode: syncAlways}
+
+// SyncNever leaves syncing to the operating system.  It suits tables
+// that are only a cache and can be rebuilt if lost.  After a power loss,
+// changes can be lost and one can be left half made.
+var SyncNever = SyncPolicy{mode: syncNever}
+
+// SyncEvery takes an interval and a number of writes and returns a
+// SyncPolicy that syncs a table file, and empties its log, once that
+// many writes have been made or that long has passed since the first
+// unsynced write, whichever comes first.  A zero interval or number of
+// writes turns that trigger off.  Unsynced changes are also synced when
+// the datastore is closed.  Each change's log entry is still synced
+// before the table file is written, so after a power loss the changes
+// the table file lost are made again from the log when it is next
+// opened.
+func SyncEvery(interval time.Duration, writes int) SyncPolicy {
+	return SyncPolicy{mode: syncEvery, interval: interval, writes: writes}
+}
+
+// WithSync takes a SyncPolicy and returns an Option that makes it the
+// policy of every table that hasn't been given one with WithTableSync.
+func WithSync(p SyncPolicy) Option {
+	return func(dsk *Disk) {
+		dsk.sync = p
+	}
+}
+
+// WithTableSync takes a table name and a SyncPolicy and returns an
+// Option that makes it the policy of that table.
+func WithTableSync(tableName string, p SyncPolicy) Option {
+	return func(dsk *Disk) {
+		dsk.syncs[tableName] = p
+	}
+}
+
+// Sync syncs the changes to every table that its policy has held back.
+func (dsk *Disk) Sync() error {
+	dsk.mu.RLock()
+	defer dsk.mu.RUnlock()
+
+	if dsk.closed {
+		return dberr.ErrClosed
+	}
+
+	for _, tableFile := range dsk.tableFiles {
+		if tableFile.wal == nil {
+			continue
+		}
+
+		if err := tableFile.wal.sync(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (dsk *Disk) syncFor(tableName string) SyncPolicy {
+	if p, ok := dsk.syncs[tableName]; ok {
+		return p
+	}
+
+	return dsk.sync
+}
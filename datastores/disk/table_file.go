@@ -2,37 +2,57 @@ package disk
 
 import (
 	"bufio"
-	"encoding/json"
+	"bytes"
+	"errors"
 	"io"
+	"math"
 	"os"
+	"sync"
+	"sync/atomic"
 
+	"github.com/jameycribbs/hare/codec"
 	"github.com/jameycribbs/hare/dberr"
 )
 
 const dummyRune = 'X'
 
+// errTruncated is why a last line with no newline can't be read.
+var errTruncated = errors.New("disk: last line has no newline")
+
+// tableFile is an open table file.  Its lock is held by every Disk
+// method that uses it, so a background compaction can replace the file
+// without racing with them.
 type tableFile struct {
-	ptr     *os.File
-	offsets map[int]int64
+	mu         sync.RWMutex
+	name       string
+	ptr        *os.File
+	wal        *wal
+	txlog      *txLog
+	offsets    map[int]int64
+	keys       map[string]int64
+	seq        int
+	free       freeList
+	batch      *[]walWrite
+	closed     bool
+	compacting atomic.Bool
 }
 
-func newTableFile(tableName string, filePtr *os.File) (*tableFile, error) {
+// newTableFile reads where every record and dummy record of a table file
+// is.  A line that can't be read as a record, or a last line with no
+// newline, is returned as a *dberr.CorruptError, unless skip isn't nil,
+// in which case it is passed to skip, without its newline, and left out.
+func newTableFile(tableName string, filePtr *os.File, c codec.Codec, skip func(line []byte, err *dberr.CorruptError)) (*tableFile, error) {
 	var currentOffset int64
 	var totalOffset int64
 	var recLen int
-	var recMap map[string]interface{}
 
 	tableFile := tableFile{
 		ptr: filePtr,
 	}
 	tableFile.offsets = make(map[int]int64)
+	tableFile.keys = make(map[string]int64)
 
-	r := bufio.NewReader(filePtr)
-
-	_, err := filePtr.Seek(0, 0)
-	if err != nil {
-		return nil, err
-	}
+	r := tableFile.reader(0)
 
 	for {
 		rec, err := r.ReadBytes('\n')
@@ -42,6 +62,18 @@ func newTableFile(tableName string, filePtr *os.File) (*tableFile, error) {
 		totalOffset += int64(recLen)
 
 		if err == io.EOF {
+			// A last line with no newline is a write that never
+			// finished.  Left alone, the next record would be
+			// appended to it.
+			if recLen > 0 {
+				corruptErr := &dberr.CorruptError{Table: tableName, Offset: currentOffset, Err: errTruncated}
+
+				if skip == nil {
+					return nil, corruptErr
+				}
+
+				skip(rec, corruptErr)
+			}
 			break
 		}
 
@@ -49,53 +81,233 @@ func newTableFile(tableName string, filePtr *os.File) (*tableFile, error) {
 			return nil, err
 		}
 
-		// Skip dummy records.
-		if (rec[0] == '\n') || (rec[0] == dummyRune) {
+		// Skip dummy records, noting the space they leave free.
+		if isDummy(rec) {
+			tableFile.free.add(currentOffset, recLen-1)
 			continue
 		}
 
-		//Unmarshal so we can grab the record ID.
-		if err := json.Unmarshal(rec, &recMap); err != nil {
-			return nil, err
+		id, key, keyed, err := readRecordRef(c, rec)
+		if err != nil {
+			corruptErr := &dberr.CorruptError{Table: tableName, Offset: currentOffset, Err: err}
+
+			if skip == nil {
+				return nil, corruptErr
+			}
+
+			skip(rec[:recLen-1], corruptErr)
+			continue
 		}
-		recMapID := int(recMap["id"].(float64))
 
-		tableFile.offsets[recMapID] = currentOffset
+		if keyed {
+			tableFile.keys[key] = currentOffset
+			continue
+		}
+
+		tableFile.offsets[id] = currentOffset
 	}
 
 	return &tableFile, nil
 }
 
 func (t *tableFile) close() error {
+	if t.wal != nil {
+		if err := t.wal.close(); err != nil {
+			return err
+		}
+	}
+
 	if err := t.ptr.Close(); err != nil {
 		return err
 	}
 
 	t.offsets = nil
+	t.keys = nil
+	t.closed = true
+
+	return nil
+}
+
+// atomically calls fn, holding back the writes it makes to the table
+// file, and then makes them all at once through the write-ahead log.
+// If fn returns an error, none of them are made.  Since fn may already
+// have changed the free list, it is then read back from the table file.
+func (t *tableFile) atomically(fn func() error) error {
+	var writes []walWrite
+
+	t.batch = &writes
+	err := fn()
+	t.batch = nil
+
+	if err == nil {
+		err = t.commit(writes)
+	}
+
+	if err != nil {
+		if loadErr := t.loadFreeList(); loadErr != nil {
+			return loadErr
+		}
+		return err
+	}
 
 	return nil
 }
 
+func (t *tableFile) commit(writes []walWrite) error {
+	if len(writes) == 0 {
+		return nil
+	}
+
+	if t.txlog != nil {
+		if err := t.txlog.logWrites(t.name, t.ptr, writes); err != nil {
+			return err
+		}
+	}
+
+	if t.wal != nil {
+		return t.wal.commit(writes)
+	}
+
+	for _, write := range writes {
+		if _, err := t.ptr.WriteAt(write.data, write.offset); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// liveCopy is a new table file that copyLive wrote: the file, open
+// for reading and writing, the sizes of the old and new files, and where
+// the records are in the new file.
+type liveCopy struct {
+	ptr     *os.File
+	oldSize int64
+	newSize int64
+	offsets map[int]int64
+	keys    map[string]int64
+}
+
+// copyLive writes the live records of the table file, in the order they
+// are stored, to a new file, which it syncs and returns open, so that
+// nothing can fail between it being renamed over the table file and the
+// table file being switched to it.
+func (t *tableFile) copyLive(path string) (*liveCopy, error) {
+	ids := make(map[int64]int, len(t.offsets))
+	for id, offset := range t.offsets {
+		ids[offset] = id
+	}
+
+	keys := make(map[int64]string, len(t.keys))
+	for key, offset := range t.keys {
+		keys[offset] = key
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0660)
+	if err != nil {
+		return nil, err
+	}
+
+	c := liveCopy{
+		ptr:     f,
+		offsets: make(map[int]int64, len(t.offsets)),
+		keys:    make(map[string]int64, len(t.keys)),
+	}
+
+	if err := t.writeLive(f, ids, keys, &c); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// writeLive writes the records at the offsets in ids and keys to f and
+// syncs it, noting the sizes and new offsets in c.
+func (t *tableFile) writeLive(f *os.File, ids map[int64]int, keys map[int64]string, c *liveCopy) error {
+	w := bufio.NewWriter(f)
+
+	r := t.reader(0)
+
+	for {
+		rec, err := r.ReadBytes('\n')
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		id, isID := ids[c.oldSize]
+		key, isKey := keys[c.oldSize]
+
+		c.oldSize += int64(len(rec))
+
+		if !isID && !isKey {
+			continue
+		}
+
+		if _, err := w.Write(rec); err != nil {
+			return err
+		}
+
+		if isID {
+			c.offsets[id] = c.newSize
+		} else {
+			c.keys[key] = c.newSize
+		}
+
+		c.newSize += int64(len(rec))
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
 func (t *tableFile) deleteRec(id int) error {
 	offset, ok := t.offsets[id]
 	if !ok {
 		return dberr.ErrNoRecord
 	}
 
-	rec, err := t.readRec(id)
-	if err != nil {
+	if err := t.atomically(func() error { return t.deleteRecAt(offset) }); err != nil {
 		return err
 	}
 
-	if err = t.overwriteRec(offset, len(rec)); err != nil {
+	delete(t.offsets, id)
+
+	return nil
+}
+
+func (t *tableFile) deleteKeyedRec(key string) error {
+	offset, ok := t.keys[key]
+	if !ok {
+		return dberr.ErrNoRecord
+	}
+
+	if err := t.atomically(func() error { return t.deleteRecAt(offset) }); err != nil {
 		return err
 	}
 
-	delete(t.offsets, id)
+	delete(t.keys, key)
 
 	return nil
 }
 
+func (t *tableFile) deleteRecAt(offset int64) error {
+	rec, err := t.readRecAt(offset)
+	if err != nil {
+		return err
+	}
+
+	return t.overwriteRec(offset, len(rec))
+}
+
 func (t *tableFile) getLastID() int {
 	var lastID int
 
@@ -120,24 +332,69 @@ func (t *tableFile) ids() []int {
 	return ids
 }
 
+// insertRec writes a new record and returns the offset it was written
+// at.
+func (t *tableFile) insertRec(rec []byte) (int64, error) {
+	if err := checkRec(rec); err != nil {
+		return 0, err
+	}
+
+	var offset int64
+
+	err := t.atomically(func() error {
+		var err error
+
+		offset, err = t.offsetForWritingRec(len(rec))
+		if err != nil {
+			return err
+		}
+
+		return t.writeRec(offset, rec)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return offset, nil
+}
+
+func (t *tableFile) keyList() []string {
+	keys := make([]string, 0, len(t.keys))
+
+	for key := range t.keys {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
 // offsetForWritingRec takes a record length and returns the offset in the file
 // where the record is to be written.  It will try to fit the record on a dummy
-// line, otherwise, it will return the offset at the end of the file.
+// line, which is taken off the free list, otherwise, it will return the offset
+// at the end of the file.
 func (t *tableFile) offsetForWritingRec(recLen int) (int64, error) {
 	var offset int64
-	var err error
 
 	// Can the record fit onto a line with a dummy record?
 	offset, recFitErr := t.offsetToFitRec(recLen)
 
 	switch recFitErr.(type) {
 	case nil:
+		slot, _ := t.free.fit(recLen)
+		t.free.remove(slot)
+
+		// Whatever the record doesn't cover is left as a shorter
+		// dummy line.
+		if slot.size > recLen {
+			t.free.add(slot.offset+int64(recLen)+1, slot.size-recLen-1)
+		}
 	case dummiesTooShortError:
 		// Go to the end of the file.
-		offset, err = t.ptr.Seek(0, 2)
+		fi, err := t.ptr.Stat()
 		if err != nil {
 			return 0, err
 		}
+		offset = fi.Size()
 	default:
 		return 0, recFitErr
 	}
@@ -145,47 +402,45 @@ func (t *tableFile) offsetForWritingRec(recLen int) (int64, error) {
 	return offset, nil
 }
 
-// offsetToFitRec takes a record length and checks all the dummy records to see
-// if any are big enough to fit the record.
+// offsetToFitRec takes a record length and looks in the free list for the
+// smallest dummy record big enough to fit the record.
 func (t *tableFile) offsetToFitRec(recLenNeeded int) (int64, error) {
-	var recLen int
+	slot, ok := t.free.fit(recLenNeeded)
+	if !ok {
+		return 0, dummiesTooShortError{}
+	}
+
+	return slot.offset, nil
+}
+
+// loadFreeList rebuilds the free list from the dummy records in the
+// table file.
+func (t *tableFile) loadFreeList() error {
 	var offset int64
-	var totalOffset int64
 
-	r := bufio.NewReader(t.ptr)
+	t.free = freeList{}
 
-	if _, err := t.ptr.Seek(0, 0); err != nil {
-		return 0, err
-	}
+	r := t.reader(0)
 
 	for {
 		rec, err := r.ReadBytes('\n')
 
-		offset = totalOffset
-		recLen = len(rec)
-		totalOffset += int64(recLen)
-
-		// Need to account for newline character.
-		recLen--
-
 		if err == io.EOF {
 			break
 		}
 
 		if err != nil {
-			return 0, err
+			return err
 		}
 
-		// If this is a dummy record, is it big enough to
-		// hold the needed record length?
-		if (rec[0] == '\n') || (rec[0] == dummyRune) {
-			if recLen >= recLenNeeded {
-				return offset, nil
-			}
+		if isDummy(rec) {
+			t.free.add(offset, len(rec)-1)
 		}
+
+		offset += int64(len(rec))
 	}
 
-	return 0, dummiesTooShortError{}
+	return nil
 }
 
 func (t *tableFile) overwriteRec(offset int64, recLen int) error {
@@ -196,10 +451,12 @@ func (t *tableFile) overwriteRec(offset int64, recLen int) error {
 		dummyData[i] = 'X'
 	}
 
-	if err := t.writeRec(offset, 0, dummyData); err != nil {
+	if err := t.writeRec(offset, dummyData); err != nil {
 		return err
 	}
 
+	t.free.add(offset, len(dummyData))
+
 	return nil
 }
 
@@ -209,13 +466,20 @@ func (t *tableFile) readRec(id int) ([]byte, error) {
 		return nil, dberr.ErrNoRecord
 	}
 
-	r := bufio.NewReader(t.ptr)
+	return t.readRecAt(offset)
+}
 
-	if _, err := t.ptr.Seek(offset, 0); err != nil {
-		return nil, err
+func (t *tableFile) readKeyedRec(key string) ([]byte, error) {
+	offset, ok := t.keys[key]
+	if !ok {
+		return nil, dberr.ErrNoRecord
 	}
 
-	rec, err := r.ReadBytes('\n')
+	return t.readRecAt(offset)
+}
+
+func (t *tableFile) readRecAt(offset int64) ([]byte, error) {
+	rec, err := t.reader(offset).ReadBytes('\n')
 	if err != nil {
 		return nil, err
 	}
@@ -223,19 +487,106 @@ func (t *tableFile) readRec(id int) ([]byte, error) {
 	return rec, err
 }
 
-func (t *tableFile) updateRec(id int, rec []byte) error {
-	recLen := len(rec)
+// reader returns a reader of the table file that starts at an offset.
+// It reads with ReadAt, which leaves the file's own offset alone, so any
+// number of readers can read the table file at once.
+func (t *tableFile) reader(offset int64) *bufio.Reader {
+	return bufio.NewReader(io.NewSectionReader(t.ptr, offset, math.MaxInt64-offset))
+}
+
+// scan reads the table file from start to end and calls fn with the id
+// and the record, without its newline, of every live record.
+func (t *tableFile) scan(fn func(id int, rec []byte) error) error {
+	var offset int64
 
+	ids := make(map[int64]int, len(t.offsets))
+	for id, recOffset := range t.offsets {
+		ids[recOffset] = id
+	}
+
+	r := t.reader(0)
+
+	for {
+		rec, err := r.ReadBytes('\n')
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if id, ok := ids[offset]; ok {
+			if err := fn(id, rec[:len(rec)-1]); err != nil {
+				return err
+			}
+		}
+
+		offset += int64(len(rec))
+	}
+
+	return nil
+}
+
+func (t *tableFile) updateRec(id int, rec []byte) error {
 	oldRecOffset, ok := t.offsets[id]
 	if !ok {
 		return dberr.ErrNoRecord
 	}
 
-	oldRec, err := t.readRec(id)
+	offset, err := t.updateAtomically(oldRecOffset, rec)
 	if err != nil {
 		return err
 	}
 
+	t.offsets[id] = offset
+
+	return nil
+}
+
+func (t *tableFile) updateKeyedRec(key string, rec []byte) error {
+	oldRecOffset, ok := t.keys[key]
+	if !ok {
+		return dberr.ErrNoRecord
+	}
+
+	offset, err := t.updateAtomically(oldRecOffset, rec)
+	if err != nil {
+		return err
+	}
+
+	t.keys[key] = offset
+
+	return nil
+}
+
+func (t *tableFile) updateAtomically(oldRecOffset int64, rec []byte) (int64, error) {
+	if err := checkRec(rec); err != nil {
+		return 0, err
+	}
+
+	var offset int64
+
+	err := t.atomically(func() error {
+		var err error
+		offset, err = t.updateRecAt(oldRecOffset, rec)
+		return err
+	})
+
+	return offset, err
+}
+
+// updateRecAt replaces the record at an offset and returns the offset
+// the changed record ends up at.
+func (t *tableFile) updateRecAt(oldRecOffset int64, rec []byte) (int64, error) {
+	recLen := len(rec)
+
+	oldRec, err := t.readRecAt(oldRecOffset)
+	if err != nil {
+		return 0, err
+	}
+
 	oldRecLen := len(oldRec)
 
 	diff := oldRecLen - (recLen + 1)
@@ -246,55 +597,89 @@ func (t *tableFile) updateRec(id int, rec []byte) error {
 
 		rec = append(rec, padRec(diff)...)
 
-		if err = t.writeRec(oldRecOffset, 0, rec); err != nil {
-			return err
+		if err = t.writeRec(oldRecOffset, rec); err != nil {
+			return 0, err
 		}
 
+		// The padding is a dummy line after the record.
+		t.free.add(oldRecOffset+int64(recLen)+1, diff-1)
+
 	} else if diff < 0 {
 		// Changed record is larger than the record in table.
 
 		recOffset, err := t.offsetForWritingRec(recLen)
 		if err != nil {
-			return err
+			return 0, err
 		}
 
-		if err = t.writeRec(recOffset, 0, rec); err != nil {
-			return err
+		if err = t.writeRec(recOffset, rec); err != nil {
+			return 0, err
 		}
 
 		// Turn the old record into a dummy.
 		if err = t.overwriteRec(oldRecOffset, oldRecLen); err != nil {
-			return err
+			return 0, err
 		}
 
-		// Update the index with the new offset since the record is in a
-		// new position in the file.
-		t.offsets[id] = recOffset
+		// The record is in a new position in the file.
+		return recOffset, nil
 	} else {
 		// Changed record is the same length as the record in the table.
-		err = t.writeRec(oldRecOffset, 0, rec)
+		err = t.writeRec(oldRecOffset, rec)
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
 
-	return nil
+	return oldRecOffset, nil
 }
 
-func (t *tableFile) writeRec(offset int64, whence int, rec []byte) error {
-	var err error
+// writeRec writes a record, followed by a newline, at an offset.  Inside
+// atomically, the write is held back to be made with the others.
+func (t *tableFile) writeRec(offset int64, rec []byte) error {
+	data := make([]byte, len(rec)+1)
+	copy(data, rec)
+	data[len(rec)] = '\n'
 
-	w := bufio.NewWriter(t.ptr)
+	write := walWrite{offset: offset, data: data}
 
-	if _, err = t.ptr.Seek(offset, whence); err != nil {
-		return err
+	if t.batch != nil {
+		*t.batch = append(*t.batch, write)
+		return nil
 	}
 
-	if _, err = w.Write(append(rec, '\n')); err != nil {
-		return err
+	return t.commit([]walWrite{write})
+}
+
+// isDummy reports whether a line of a table file is a dummy record.
+func isDummy(rec []byte) bool {
+	return rec[0] == '\n' || rec[0] == dummyRune
+}
+
+// readRecordRef decodes just enough of a record to grab its ID, or its
+// key if the ID is a string.
+func readRecordRef(c codec.Codec, rec []byte) (int, string, bool, error) {
+	id, err := codec.RecordID(c, rec)
+	if err == nil {
+		return id, "", false, nil
+	}
+
+	key, keyErr := codec.RecordKey(c, rec)
+	if keyErr != nil {
+		return 0, "", false, err
 	}
 
-	w.Flush()
+	return 0, key, true, nil
+}
+
+// checkRec returns dberr.ErrBadRecord if a record can't be written as a
+// line of its own: if it is empty or starts with a dummy record's first
+// byte, it would be read back as a dummy record and lost, and a newline
+// would split it in two.
+func checkRec(rec []byte) error {
+	if len(rec) == 0 || isDummy(rec) || bytes.IndexByte(rec, '\n') >= 0 {
+		return dberr.ErrBadRecord
+	}
 
 	return nil
 }
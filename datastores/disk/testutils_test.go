@@ -5,6 +5,8 @@ import (
 	"os/exec"
 	"strconv"
 	"testing"
+
+	"github.com/jameycribbs/hare/codec"
 )
 
 func runTestFns(t *testing.T, tests []func(t *testing.T)) {
@@ -15,12 +17,15 @@ func runTestFns(t *testing.T, tests []func(t *testing.T)) {
 	}
 }
 
-func newTestDisk(t *testing.T) *Disk {
-	dsk, err := New("./testdata", ".json")
+func newTestDisk(t *testing.T, opts ...Option) *Disk {
+	dsk, err := New("./testdata", ".json", opts...)
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	// Release the lock on testdata, if the test didn't close dsk.
+	t.Cleanup(func() { dsk.Close() })
+
 	return dsk
 }
 
@@ -30,7 +35,7 @@ func newTestTableFile(t *testing.T) *tableFile {
 		t.Fatal(err)
 	}
 
-	tf, err := newTableFile("contacts", filePtr)
+	tf, err := newTableFile("contacts", filePtr, codec.JSON, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -52,7 +57,7 @@ func testTeardown(t *testing.T) {
 }
 
 func testRemoveFiles(t *testing.T) {
-	filesToRemove := []string{"contacts.json", "newtable.json"}
+	filesToRemove := []string{"contacts.json", "contacts.seq", "contacts.seq.tmp", "contacts.wal", "contacts.idx", "newtable.json", "newtable.seq", "newtable.wal", "contacts.quarantine", "hare.lock", "hare.txlog"}
 
 	for _, f := range filesToRemove {
 		err := os.Remove("./testdata/" + f)
@@ -61,3 +66,19 @@ func testRemoveFiles(t *testing.T) {
 		}
 	}
 }
+
+func testAppendLines(t *testing.T, lines ...string) {
+	t.Helper()
+
+	f, err := os.OpenFile("./testdata/contacts.json", os.O_APPEND|os.O_WRONLY, 0660)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range lines {
+		if _, err := f.WriteString(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,444 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// txLogFileName is the name of the file, in the database directory, that
+// holds the transaction log.
+const txLogFileName = "hare.txlog"
+
+// txLogMagic starts every transaction log entry.
+var txLogMagic = []byte("HTXL")
+
+// Batch takes the names of some tables and a function that changes
+// them, and calls the function.  Before each change it makes to one of
+// the table files, what the change overwrites, and the size of the file,
+// are saved in the database directory's transaction log, "hare.txlog",
+// and synced.  Once the function returns, the tables are synced and the
+// log is emptied.  If the process dies or the machine loses power before
+// then, the changes are rolled back when the datastore is next opened,
+// so either every change is kept or none is.
+//
+// Batch doesn't undo the changes if the function returns an error; it
+// returns the error.  Nothing else may change the tables while Batch
+// runs, and batches are made one at a time.  If the tables can't be
+// synced, the batch is rolled back when the datastore is next opened,
+// and until then Batch and every change to the tables return the error.
+func (dsk *Disk) Batch(tableNames []string, fn func() error) error {
+	if err := dsk.writable(); err != nil {
+		return err
+	}
+
+	for _, tableName := range tableNames {
+		if _, err := dsk.getTableFile(tableName); err != nil {
+			return err
+		}
+	}
+
+	l := dsk.txlog
+
+	l.batchMu.Lock()
+	defer l.batchMu.Unlock()
+
+	if err := l.begin(tableNames); err != nil {
+		return err
+	}
+
+	err := fn()
+
+	if endErr := l.end(dsk.syncTable); endErr != nil {
+		return errors.Join(err, endErr)
+	}
+
+	return err
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+// txLog is the transaction log of a Disk, which makes a Batch all or
+// nothing.  Where a table's write-ahead log holds the changes to make,
+// so they can be made again, the transaction log holds what the changes
+// of the batch under way overwrote, so they can be undone.
+type txLog struct {
+	batchMu sync.Mutex
+
+	mu           sync.Mutex
+	ptr          *os.File
+	size         int64
+	tables       map[string]bool
+	touched      map[string]bool
+	failed       error
+	failedTables map[string]bool
+}
+
+// txUndo is a transaction log entry: what a change to a table file
+// overwrote, and the size of the file before it.
+type txUndo struct {
+	tableName string
+	size      int64
+	writes    []walWrite
+}
+
+// openTxLog rolls back the batch left in the transaction log, if there
+// is one, and opens the log for the batches to come.  With a shared
+// lock, the log is only checked, since rolling back a batch means
+// writing to the table files.
+func (dsk *Disk) openTxLog() error {
+	p := filepath.Join(dsk.path, txLogFileName)
+
+	if dsk.lockMode == LockShared {
+		fi, err := os.Stat(p)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		if err == nil && fi.Size() > 0 {
+			return fmt.Errorf("disk: %s holds a batch to roll back, open the datastore for writing first: %w", txLogFileName, dberr.ErrReadOnly)
+		}
+
+		return nil
+	}
+
+	filePtr, err := os.OpenFile(p, os.O_CREATE|os.O_RDWR, 0660)
+	if err != nil {
+		return err
+	}
+
+	l := &txLog{ptr: filePtr}
+
+	if _, err := dsk.rollBack(l); err != nil {
+		filePtr.Close()
+		return err
+	}
+
+	dsk.txlog = l
+
+	return nil
+}
+
+// rollBack undoes the batch left in a transaction log, in reverse
+// order, and empties the log.  Each table's write-ahead log is replayed
+// first, since it may hold changes the batch made after saving what
+// they overwrote.  It returns the tables that were changed.
+func (dsk *Disk) rollBack(l *txLog) ([]string, error) {
+	undos, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var tableNames []string
+	filePtrs := make(map[string]*os.File)
+
+	defer func() {
+		for _, filePtr := range filePtrs {
+			if filePtr != nil {
+				filePtr.Close()
+			}
+		}
+	}()
+
+	for _, undo := range undos {
+		if _, ok := filePtrs[undo.tableName]; ok {
+			continue
+		}
+
+		filePtr, err := os.OpenFile(filepath.Join(dsk.path, undo.tableName+dsk.ext), os.O_RDWR, 0660)
+		if errors.Is(err, fs.ErrNotExist) {
+			// The table has since been removed.
+			filePtrs[undo.tableName] = nil
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		filePtrs[undo.tableName] = filePtr
+
+		if err := dsk.replayWAL(undo.tableName, filePtr); err != nil {
+			return nil, err
+		}
+
+		tableNames = append(tableNames, undo.tableName)
+	}
+
+	for i := len(undos) - 1; i >= 0; i-- {
+		filePtr := filePtrs[undos[i].tableName]
+		if filePtr == nil {
+			continue
+		}
+
+		for _, write := range undos[i].writes {
+			if _, err := filePtr.WriteAt(write.data, write.offset); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := filePtr.Truncate(undos[i].size); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, tableName := range tableNames {
+		if err := filePtrs[tableName].Sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := l.reset(); err != nil {
+		return nil, err
+	}
+
+	return tableNames, nil
+}
+
+// syncTable syncs a table file changed by a batch, and empties its
+// write-ahead log.
+func (dsk *Disk) syncTable(tableName string) error {
+	tableFile, err := dsk.getTableFile(tableName)
+	if err != nil {
+		return err
+	}
+
+	return tableFile.wal.sync()
+}
+
+func (l *txLog) close() error {
+	return l.ptr.Close()
+}
+
+// begin starts a batch of changes to some tables.
+func (l *txLog) begin(tableNames []string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.failed != nil {
+		return l.failed
+	}
+
+	l.tables = make(map[string]bool)
+	l.touched = make(map[string]bool)
+
+	for _, tableName := range tableNames {
+		l.tables[tableName] = true
+	}
+
+	return nil
+}
+
+// end syncs the tables the batch changed and empties the log.  If that
+// fails, the log is failed: the batch is left in it, to be rolled back
+// the next time the datastore is opened, and every later batch, and
+// change to its tables, returns the error.
+func (l *txLog) end(syncTable func(tableName string) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tables := l.tables
+	touched := l.touched
+
+	l.tables = nil
+	l.touched = nil
+
+	for tableName := range touched {
+		if err := syncTable(tableName); err != nil {
+			return l.fail(tables, err)
+		}
+	}
+
+	if l.size == 0 {
+		return nil
+	}
+
+	if err := l.reset(); err != nil {
+		return l.fail(tables, err)
+	}
+
+	return nil
+}
+
+func (l *txLog) fail(tables map[string]bool, err error) error {
+	l.failed = fmt.Errorf("disk: batch can't be finished, it is rolled back when the datastore is next opened: %w", err)
+	l.failedTables = tables
+
+	return l.failed
+}
+
+// holds reports whether a table is part of the batch under way.  It
+// returns the error of a failed log for the tables of its batch.
+func (l *txLog) holds(tableName string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.failedTables[tableName] {
+		return true, l.failed
+	}
+
+	return l.tables[tableName], nil
+}
+
+// logWrites saves what a set of writes to a table file of the batch
+// under way will overwrite, before they are made.  Writes to other
+// tables aren't logged.
+func (l *txLog) logWrites(tableName string, table *os.File, writes []walWrite) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.failedTables[tableName] {
+		return l.failed
+	}
+
+	if !l.tables[tableName] {
+		return nil
+	}
+
+	fi, err := table.Stat()
+	if err != nil {
+		return err
+	}
+
+	undo := txUndo{tableName: tableName, size: fi.Size()}
+
+	for _, write := range writes {
+		if write.offset >= undo.size {
+			continue
+		}
+
+		data := make([]byte, min(int64(len(write.data)), undo.size-write.offset))
+		if _, err := table.ReadAt(data, write.offset); err != nil {
+			return err
+		}
+
+		undo.writes = append(undo.writes, walWrite{offset: write.offset, data: data})
+	}
+
+	if err := l.append(encodeTxEntry(undo)); err != nil {
+		return err
+	}
+
+	l.touched[tableName] = true
+
+	return nil
+}
+
+// append writes an entry to the end of the log and syncs it.  If either
+// fails, the log is truncated back to where it was, and if that fails
+// too, the log is failed.
+func (l *txLog) append(entry []byte) error {
+	_, err := l.ptr.WriteAt(entry, l.size)
+	if err == nil {
+		err = l.ptr.Sync()
+	}
+
+	if err != nil {
+		if truncErr := l.ptr.Truncate(l.size); truncErr != nil {
+			return l.fail(l.tables, errors.Join(err, truncErr))
+		}
+		return err
+	}
+
+	l.size += int64(len(entry))
+
+	return nil
+}
+
+// read returns the complete entries in the log.  An incomplete entry
+// means the process died before its change was made, so it, and
+// anything after it, is ignored.
+func (l *txLog) read() ([]txUndo, error) {
+	if _, err := l.ptr.Seek(0, 0); err != nil {
+		return nil, err
+	}
+
+	log, err := io.ReadAll(l.ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	var undos []txUndo
+
+	for len(log) > 0 {
+		payload, entryLen, ok := decodeEntry(txLogMagic, log)
+		if !ok {
+			break
+		}
+
+		undo, ok := decodeTxEntry(payload)
+		if !ok {
+			break
+		}
+
+		undos = append(undos, undo)
+		log = log[entryLen:]
+	}
+
+	return undos, nil
+}
+
+// reset empties the log and syncs it, so a finished batch is never
+// rolled back.
+func (l *txLog) reset() error {
+	if err := l.ptr.Truncate(0); err != nil {
+		return err
+	}
+
+	if err := l.ptr.Sync(); err != nil {
+		return err
+	}
+
+	l.size = 0
+
+	return nil
+}
+
+// encodeTxEntry returns a transaction log entry holding what a change
+// overwrote.
+func encodeTxEntry(undo txUndo) []byte {
+	var payload bytes.Buffer
+
+	binary.Write(&payload, binary.BigEndian, uint16(len(undo.tableName)))
+	payload.WriteString(undo.tableName)
+	binary.Write(&payload, binary.BigEndian, undo.size)
+	encodeWrites(&payload, undo.writes)
+
+	return encodeEntry(txLogMagic, payload.Bytes())
+}
+
+// decodeTxEntry returns what the payload of a transaction log entry
+// holds, or false if it is incomplete.
+func decodeTxEntry(payload []byte) (txUndo, bool) {
+	var undo txUndo
+
+	if len(payload) < 2 {
+		return undo, false
+	}
+
+	nameLen := int(binary.BigEndian.Uint16(payload))
+	payload = payload[2:]
+
+	if len(payload) < nameLen+8 {
+		return undo, false
+	}
+
+	undo.tableName = string(payload[:nameLen])
+	undo.size = int64(binary.BigEndian.Uint64(payload[nameLen:]))
+
+	writes, ok := decodeWrites(payload[nameLen+8:])
+	if !ok {
+		return undo, false
+	}
+	undo.writes = writes
+
+	return undo, true
+}
@@ -0,0 +1,225 @@
+package disk
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestBatchTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//Batch...
+
+			dsk := newTestDisk(t)
+
+			rec := `{"id":3,"first_name":"William","last_name":"Shakespeare","age":18}`
+
+			err := dsk.Batch([]string{"contacts"}, func() error {
+				if err := dsk.UpdateRec("contacts", 3, []byte(rec)); err != nil {
+					return err
+				}
+
+				return dsk.DeleteRec("contacts", 1)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			testCheckTxLogEmpty(t)
+
+			got, err := dsk.ReadRec("contacts", 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := rec + "\n"; want != string(got) {
+				t.Errorf("want %v; got %v", want, string(got))
+			}
+
+			if _, err := dsk.ReadRec("contacts", 1); !errors.Is(err, dberr.ErrNoRecord) {
+				t.Errorf("want %v; got %v", dberr.ErrNoRecord, err)
+			}
+		},
+		func(t *testing.T) {
+			//Batch (function fails)...
+
+			dsk := newTestDisk(t)
+
+			errFailed := errors.New("failed")
+
+			err := dsk.Batch([]string{"contacts"}, func() error {
+				if err := dsk.DeleteRec("contacts", 1); err != nil {
+					return err
+				}
+
+				return errFailed
+			})
+			if !errors.Is(err, errFailed) {
+				t.Errorf("want %v; got %v", errFailed, err)
+			}
+
+			// The change isn't undone, and the log is emptied.
+			if _, err := dsk.ReadRec("contacts", 1); !errors.Is(err, dberr.ErrNoRecord) {
+				t.Errorf("want %v; got %v", dberr.ErrNoRecord, err)
+			}
+
+			testCheckTxLogEmpty(t)
+		},
+		func(t *testing.T) {
+			//Batch (rolled back when opened)...
+
+			dsk := newTestDisk(t)
+
+			if err := dsk.CreateTable("newtable"); err != nil {
+				t.Fatal(err)
+			}
+
+			var log []byte
+
+			err := dsk.Batch([]string{"contacts"}, func() error {
+				if err := dsk.UpdateRec("contacts", 3, []byte(`{"id":3,"first_name":"William","last_name":"Shakespeare","age":18}`)); err != nil {
+					return err
+				}
+
+				if err := dsk.DeleteRec("contacts", 1); err != nil {
+					return err
+				}
+
+				if err := dsk.InsertRec("contacts", 5, []byte(`{"id":5,"first_name":"Rex","last_name":"Stout","age":77}`)); err != nil {
+					return err
+				}
+
+				// A table that isn't part of the batch isn't logged.
+				if err := dsk.InsertRec("newtable", 1, []byte(`{"id":1,"first_name":"Jane","last_name":"Roe","age":30}`)); err != nil {
+					return err
+				}
+
+				// Keep the log as a crash here would leave it.
+				var err error
+				log, err = os.ReadFile("./testdata/" + txLogFileName)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.WriteFile("./testdata/"+txLogFileName, log, 0660); err != nil {
+				t.Fatal(err)
+			}
+
+			// A shared lock can't roll the batch back.
+			if _, err := New("./testdata", ".json", WithLock(LockShared)); !errors.Is(err, dberr.ErrReadOnly) {
+				t.Fatalf("want %v; got %v", dberr.ErrReadOnly, err)
+			}
+
+			newTestDisk(t)
+
+			testCheckTxLogEmpty(t)
+
+			want, err := os.ReadFile("./testdata/contacts.bak")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile("./testdata/contacts.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(want) != string(got) {
+				t.Errorf("want %v; got %v", string(want), string(got))
+			}
+
+			b, err := os.ReadFile("./testdata/newtable.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(b) == 0 {
+				t.Errorf("want %v; got %v", "a record", string(b))
+			}
+		},
+		func(t *testing.T) {
+			//Batch (table isn't compacted)...
+
+			dsk := newTestDisk(t, WithAutoCompact(CompactThreshold{Ratio: 0.1}))
+
+			var log []byte
+
+			err := dsk.Batch([]string{"contacts"}, func() error {
+				if err := dsk.DeleteRec("contacts", 2); err != nil {
+					return err
+				}
+
+				// Let the compaction the delete started finish.
+				dsk.compactions.Wait()
+
+				var err error
+				log, err = os.ReadFile("./testdata/" + txLogFileName)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.WriteFile("./testdata/"+txLogFileName, log, 0660); err != nil {
+				t.Fatal(err)
+			}
+
+			newTestDisk(t)
+
+			want, err := os.ReadFile("./testdata/contacts.bak")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile("./testdata/contacts.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(want) != string(got) {
+				t.Errorf("want %v; got %v", string(want), string(got))
+			}
+		},
+		func(t *testing.T) {
+			//Batch (NoTable error)...
+
+			dsk := newTestDisk(t)
+
+			err := dsk.Batch([]string{"contacts", "nonexistent"}, func() error {
+				t.Error("want the function not to be called")
+				return nil
+			})
+			if !errors.Is(err, dberr.ErrNoTable) {
+				t.Errorf("want %v; got %v", dberr.ErrNoTable, err)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
+func testCheckTxLogEmpty(t *testing.T) {
+	fi, err := os.Stat("./testdata/" + txLogFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want int64
+	got := fi.Size()
+	if want != got {
+		t.Errorf("want %v; got %v", want, got)
+	}
+}
@@ -0,0 +1,363 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// walExt is the extension of a table's write-ahead log, which sits
+// alongside the table file.
+const walExt = ".wal"
+
+// walMagic starts every write-ahead log entry.
+var walMagic = []byte("HWAL")
+
+// walHeaderLen is the length of an entry's header: the magic, the
+// length of the payload and the payload's CRC-32.
+const walHeaderLen = 12
+
+// walWrite is a single write to a table file: the bytes to write and the
+// offset to write them at.
+type walWrite struct {
+	offset int64
+	data   []byte
+}
+
+// wal is the write-ahead log of a table file.  Every change to the table
+// file is first written to the log as one entry, and only then made to
+// the table file.  Once the table file is synced, the log is emptied.
+// If the process dies part way through, the entries left in the log are
+// replayed the next time the table is opened, so a change is either
+// made in full or not at all.
+//
+// When the log and the table file are synced is set by the table's
+// SyncPolicy.  With SyncAlways and SyncEvery, each entry is synced
+// before the table file is written, so a change is made in full or not
+// at all even if the machine loses power.  SyncAlways also syncs the
+// table file and empties the log on every change, while with SyncEvery
+// the entries pile up in the log until the table file is synced, after
+// a number of writes or once an interval has passed.  SyncNever syncs
+// neither, so a change is only made in full or not at all if the
+// process dies.
+type wal struct {
+	mu      sync.Mutex
+	ptr     *os.File
+	table   *os.File
+	policy  SyncPolicy
+	size    int64
+	pending int
+	timer   *time.Timer
+	err     error
+	failed  error
+}
+
+func openWAL(path string, table *os.File, policy SyncPolicy) (*wal, error) {
+	filePtr, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0660)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wal{ptr: filePtr, table: table, policy: policy}, nil
+}
+
+// close syncs any changes the policy has held back and closes the log.
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.pending > 0 && w.failed == nil {
+		if err := w.syncLocked(); err != nil {
+			return err
+		}
+	}
+
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+
+	return w.ptr.Close()
+}
+
+// commit logs a set of writes and makes them to the table file.  The
+// log is then synced and emptied as the policy says.  If the entry
+// can't be logged, the table file isn't touched.
+//
+// If the writes to the table file fail, some of them may have been made
+// already, so they are all made again, as replaying the log would.  If
+// that fails too, the log is failed: the entry is left in it, to be
+// replayed the next time the table is opened, and every later change
+// returns the error, so the table file never drifts further from what
+// the datastore holds in memory.
+func (w *wal) commit(writes []walWrite) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.failed != nil {
+		return w.failed
+	}
+
+	// A failed background sync is reported by the next change.
+	if w.err != nil {
+		err := w.err
+		w.err = nil
+		return err
+	}
+
+	if err := w.append(encodeWALEntry(writes)); err != nil {
+		return err
+	}
+
+	if err := w.writeTable(writes); err != nil {
+		if err := w.writeTable(writes); err != nil {
+			w.failed = fmt.Errorf("disk: table file can't be written, its logged change is made when it is next opened: %w", err)
+			return w.failed
+		}
+	}
+
+	w.pending++
+
+	switch w.policy.mode {
+	case syncNever:
+		return w.reset()
+	case syncEvery:
+		if w.policy.writes > 0 && w.pending >= w.policy.writes {
+			return w.syncLocked()
+		}
+
+		if w.policy.interval > 0 && w.timer == nil {
+			w.timer = time.AfterFunc(w.policy.interval, w.flush)
+		}
+
+		return nil
+	default:
+		return w.syncLocked()
+	}
+}
+
+// append writes an entry to the end of the log and syncs it, unless
+// the policy is SyncNever.  If either fails, the log is truncated back to where
+// it was, so a change that returned an error is never replayed.  If
+// that fails too, the log is failed.
+func (w *wal) append(entry []byte) error {
+	_, err := w.ptr.WriteAt(entry, w.size)
+	if err == nil && w.policy.mode != syncNever {
+		err = w.ptr.Sync()
+	}
+
+	if err != nil {
+		if truncErr := w.ptr.Truncate(w.size); truncErr != nil {
+			w.failed = fmt.Errorf("disk: log can't be written or truncated, a change that failed may be made when the table is next opened: %w", errors.Join(err, truncErr))
+			return w.failed
+		}
+		return err
+	}
+
+	w.size += int64(len(entry))
+
+	return nil
+}
+
+// writeTable makes a set of writes to the table file.
+func (w *wal) writeTable(writes []walWrite) error {
+	for _, write := range writes {
+		if _, err := w.table.WriteAt(write.data, write.offset); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setTable points the log at a new table file, after the old one has
+// been replaced.
+func (w *wal) setTable(table *os.File) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.table = table
+}
+
+// sync syncs the table file and empties the log, whatever the policy.
+func (w *wal) sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.syncLocked()
+}
+
+// flush is run by the timer of a SyncEvery policy.  An error is kept to
+// be returned by the next commit.
+func (w *wal) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.pending == 0 {
+		return
+	}
+
+	if err := w.syncLocked(); err != nil {
+		w.err = err
+	}
+}
+
+func (w *wal) syncLocked() error {
+	// The log of a failed table still holds a change the table file
+	// may not have, so it must not be emptied.
+	if w.failed != nil {
+		return w.failed
+	}
+
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+
+	if err := w.table.Sync(); err != nil {
+		return err
+	}
+
+	return w.reset()
+}
+
+// reset empties the log.  Every entry in it has already been made to
+// the table file.
+func (w *wal) reset() error {
+	if err := w.ptr.Truncate(0); err != nil {
+		return err
+	}
+
+	w.size = 0
+	w.pending = 0
+
+	return nil
+}
+
+// replay makes the writes of the complete entries left in the log to
+// the table file, in order.  An incomplete entry means the process died
+// before the table file was touched, so it, and anything after it, is
+// thrown away.
+func (w *wal) replay() error {
+	if _, err := w.ptr.Seek(0, 0); err != nil {
+		return err
+	}
+
+	log, err := io.ReadAll(w.ptr)
+	if err != nil {
+		return err
+	}
+
+	for len(log) > 0 {
+		payload, entryLen, ok := decodeEntry(walMagic, log)
+		if !ok {
+			break
+		}
+
+		writes, ok := decodeWrites(payload)
+		if !ok {
+			break
+		}
+
+		for _, write := range writes {
+			if _, err := w.table.WriteAt(write.data, write.offset); err != nil {
+				return err
+			}
+		}
+
+		log = log[entryLen:]
+	}
+
+	return w.syncLocked()
+}
+
+// encodeWALEntry returns a log entry holding a set of writes.
+func encodeWALEntry(writes []walWrite) []byte {
+	var payload bytes.Buffer
+
+	encodeWrites(&payload, writes)
+
+	return encodeEntry(walMagic, payload.Bytes())
+}
+
+// decodeWALEntry returns the writes held in a log entry, or false if
+// there is no complete entry.
+func decodeWALEntry(entry []byte) ([]walWrite, bool) {
+	payload, _, ok := decodeEntry(walMagic, entry)
+	if !ok {
+		return nil, false
+	}
+
+	return decodeWrites(payload)
+}
+
+// encodeEntry returns a log entry: the magic, the length of the payload,
+// the payload's CRC-32 and the payload.
+func encodeEntry(magic []byte, payload []byte) []byte {
+	entry := make([]byte, walHeaderLen, walHeaderLen+len(payload))
+	copy(entry, magic)
+	binary.BigEndian.PutUint32(entry[4:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(entry[8:], crc32.ChecksumIEEE(payload))
+
+	return append(entry, payload...)
+}
+
+// decodeEntry returns the payload of the log entry at the start of log
+// and the length of the entry, or false if there is no complete entry.
+func decodeEntry(magic []byte, log []byte) ([]byte, int, bool) {
+	if len(log) < walHeaderLen || !bytes.Equal(log[:4], magic) {
+		return nil, 0, false
+	}
+
+	payloadLen := int(binary.BigEndian.Uint32(log[4:]))
+	if len(log)-walHeaderLen < payloadLen {
+		return nil, 0, false
+	}
+
+	payload := log[walHeaderLen : walHeaderLen+payloadLen]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(log[8:]) {
+		return nil, 0, false
+	}
+
+	return payload, walHeaderLen + payloadLen, true
+}
+
+// encodeWrites appends a set of writes to a payload.
+func encodeWrites(payload *bytes.Buffer, writes []walWrite) {
+	for _, write := range writes {
+		binary.Write(payload, binary.BigEndian, write.offset)
+		binary.Write(payload, binary.BigEndian, uint32(len(write.data)))
+		payload.Write(write.data)
+	}
+}
+
+// decodeWrites returns the writes a payload holds, or false if it holds
+// part of one.
+func decodeWrites(payload []byte) ([]walWrite, bool) {
+	var writes []walWrite
+
+	for len(payload) > 0 {
+		if len(payload) < 12 {
+			return nil, false
+		}
+
+		offset := int64(binary.BigEndian.Uint64(payload))
+		dataLen := int(binary.BigEndian.Uint32(payload[8:]))
+		payload = payload[12:]
+
+		if len(payload) < dataLen {
+			return nil, false
+		}
+
+		writes = append(writes, walWrite{offset: offset, data: payload[:dataLen]})
+		payload = payload[dataLen:]
+	}
+
+	return writes, true
+}
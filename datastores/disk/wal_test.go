@@ -0,0 +1,318 @@
+package disk
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWALTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//encodeWALEntry and decodeWALEntry...
+
+			want := []walWrite{
+				{offset: 160, data: []byte("XXXX\n")},
+				{offset: 288, data: []byte("{\"id\":3}\n")},
+			}
+
+			got, ok := decodeWALEntry(encodeWALEntry(want))
+			if !ok {
+				t.Fatalf("want %v; got %v", true, ok)
+			}
+
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//replay (complete entry)...
+
+			rec := "{\"id\":3,\"first_name\":\"Will\",\"last_name\":\"Shakespeare\",\"age\":18}\n"
+
+			testWriteWAL(t, encodeWALEntry([]walWrite{{offset: 160, data: []byte(rec)}}))
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			got, err := dsk.ReadRec("contacts", 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rec != string(got) {
+				t.Errorf("want %v; got %v", rec, string(got))
+			}
+
+			testCheckWALEmpty(t)
+		},
+		func(t *testing.T) {
+			//replay (torn entry)...
+
+			rec := "{\"id\":3,\"first_name\":\"Will\",\"last_name\":\"Shakespeare\",\"age\":18}\n"
+			entry := encodeWALEntry([]walWrite{{offset: 160, data: []byte(rec)}})
+
+			testWriteWAL(t, entry[:len(entry)-10])
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			got, err := dsk.ReadRec("contacts", 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := "{\"id\":3,\"first_name\":\"Bill\",\"last_name\":\"Shakespeare\",\"age\":18}\n"
+			if want != string(got) {
+				t.Errorf("want %v; got %v", want, string(got))
+			}
+
+			testCheckWALEmpty(t)
+		},
+		func(t *testing.T) {
+			//commit (log is emptied)...
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			if err := dsk.UpdateRec("contacts", 3, []byte(`{"id":3,"first_name":"William","last_name":"Shakespeare","age":18}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			testCheckWALEmpty(t)
+		},
+		func(t *testing.T) {
+			//replay (several entries)...
+
+			rec3 := "{\"id\":3,\"first_name\":\"Will\",\"last_name\":\"Shakespeare\",\"age\":18}\n"
+			rec3b := "{\"id\":3,\"first_name\":\"Bard\",\"last_name\":\"Shakespeare\",\"age\":18}\n"
+
+			log := encodeWALEntry([]walWrite{{offset: 160, data: []byte(rec3)}})
+			log = append(log, encodeWALEntry([]walWrite{{offset: 160, data: []byte(rec3b)}})...)
+
+			testWriteWAL(t, log)
+
+			dsk := newTestDisk(t)
+			defer dsk.Close()
+
+			got, err := dsk.ReadRec("contacts", 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := "{\"id\":3,\"first_name\":\"Bard\",\"last_name\":\"Shakespeare\",\"age\":18}\n"
+			if want != string(got) {
+				t.Errorf("want %v; got %v", want, string(got))
+			}
+
+			testCheckWALEmpty(t)
+		},
+		func(t *testing.T) {
+			//commit (log can't be written)...
+
+			dsk := newTestDisk(t)
+
+			readOnly, err := os.Open("./testdata/contacts" + walExt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer readOnly.Close()
+
+			w := dsk.tableFiles["contacts"].wal
+			logPtr := w.ptr
+			w.ptr = readOnly
+
+			rec := `{"id":3,"first_name":"Will","last_name":"Shakespeare","age":18}`
+
+			firstErr := dsk.UpdateRec("contacts", 3, []byte(rec))
+			if firstErr == nil {
+				t.Fatalf("want %v; got %v", "error", firstErr)
+			}
+
+			// The log can't be truncated back either, so the table is
+			// failed and later changes are refused.
+			rec4 := `{"id":4,"first_name":"Hazel","last_name":"Keller","age":25}`
+			if gotErr := dsk.UpdateRec("contacts", 4, []byte(rec4)); !errors.Is(gotErr, firstErr) {
+				t.Errorf("want %v; got %v", firstErr, gotErr)
+			}
+
+			w.ptr = logPtr
+			dsk.Close()
+
+			dsk = newTestDisk(t)
+			defer dsk.Close()
+
+			got, err := dsk.ReadRec("contacts", 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := `{"id":3,"first_name":"Bill","last_name":"Shakespeare","age":18}` + "\n"; want != string(got) {
+				t.Errorf("want %v; got %v", want, string(got))
+			}
+		},
+		func(t *testing.T) {
+			//commit (table file can't be written)...
+
+			dsk := newTestDisk(t)
+
+			readOnly, err := os.Open("./testdata/contacts.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer readOnly.Close()
+
+			dsk.tableFiles["contacts"].wal.setTable(readOnly)
+
+			rec := `{"id":3,"first_name":"Will","last_name":"Shakespeare","age":18}`
+
+			firstErr := dsk.UpdateRec("contacts", 3, []byte(rec))
+			if firstErr == nil {
+				t.Fatalf("want %v; got %v", "error", firstErr)
+			}
+
+			// The table is failed, so later changes and syncs are
+			// refused, and the change stays in the log.
+			if gotErr := dsk.UpdateRec("contacts", 4, []byte(`{"id":4,"first_name":"Hazel","last_name":"Keller","age":25}`)); !errors.Is(gotErr, firstErr) {
+				t.Errorf("want %v; got %v", firstErr, gotErr)
+			}
+
+			if gotErr := dsk.Sync(); !errors.Is(gotErr, firstErr) {
+				t.Errorf("want %v; got %v", firstErr, gotErr)
+			}
+
+			testCheckWALNotEmpty(t)
+
+			dsk.Close()
+
+			// The change is made when the table is opened again.
+			dsk = newTestDisk(t)
+
+			got, err := dsk.ReadRec("contacts", 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := rec + "\n"; want != string(got) {
+				t.Errorf("want %v; got %v", want, string(got))
+			}
+
+			testCheckWALEmpty(t)
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
+func TestSyncPolicyTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//SyncEvery (writes)...
+
+			dsk := newTestDisk(t, WithSync(SyncEvery(0, 3)))
+			defer dsk.Close()
+
+			for i := 0; i < 2; i++ {
+				testUpdateContact(t, dsk)
+			}
+
+			testCheckWALNotEmpty(t)
+
+			testUpdateContact(t, dsk)
+
+			testCheckWALEmpty(t)
+		},
+		func(t *testing.T) {
+			//SyncEvery (interval)...
+
+			dsk := newTestDisk(t, WithSync(SyncEvery(10*time.Millisecond, 0)))
+			defer dsk.Close()
+
+			testUpdateContact(t, dsk)
+
+			testCheckWALNotEmpty(t)
+
+			deadline := time.Now().Add(5 * time.Second)
+			for testWALSize(t) > 0 && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			testCheckWALEmpty(t)
+		},
+		func(t *testing.T) {
+			//SyncNever...
+
+			dsk := newTestDisk(t, WithSync(SyncNever))
+			defer dsk.Close()
+
+			testUpdateContact(t, dsk)
+
+			testCheckWALEmpty(t)
+		},
+		func(t *testing.T) {
+			//WithTableSync, Sync, Close...
+
+			dsk := newTestDisk(t, WithSync(SyncNever), WithTableSync("contacts", SyncEvery(0, 100)))
+
+			testUpdateContact(t, dsk)
+
+			testCheckWALNotEmpty(t)
+
+			if err := dsk.Sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			testCheckWALEmpty(t)
+
+			testUpdateContact(t, dsk)
+
+			if err := dsk.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			testCheckWALEmpty(t)
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
+// testWriteWAL leaves an entry in the contacts table's write-ahead log,
+// as if the process had died before emptying it.
+func testWriteWAL(t *testing.T, entry []byte) {
+	if err := os.WriteFile("./testdata/contacts"+walExt, entry, 0660); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testCheckWALEmpty(t *testing.T) {
+	var want int64
+	got := testWALSize(t)
+	if want != got {
+		t.Errorf("want %v; got %v", want, got)
+	}
+}
+
+func testCheckWALNotEmpty(t *testing.T) {
+	if got := testWALSize(t); got == 0 {
+		t.Errorf("want %v; got %v", "entries in the log", got)
+	}
+}
+
+func testWALSize(t *testing.T) int64 {
+	fi, err := os.Stat("./testdata/contacts" + walExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fi.Size()
+}
+
+// testUpdateContact rewrites contact 3 in place.
+func testUpdateContact(t *testing.T, dsk *Disk) {
+	if err := dsk.UpdateRec("contacts", 3, []byte(`{"id":3,"first_name":"Bill","last_name":"Shakespeare","age":18}`)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,19 @@
+package ram
+
+import (
+	"testing"
+
+	"github.com/jameycribbs/hare"
+	"github.com/jameycribbs/hare/datastores/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) hare.Datastore {
+		ram, err := New(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return ram
+	})
+}
@@ -1,11 +1,17 @@
 package ram
 
-import "github.com/jameycribbs/hare/dberr"
+import (
+	"sync"
+
+	"github.com/jameycribbs/hare/dberr"
+)
 
 // Ram is a struct that holds a map of all the
 // tables in the datastore.
 type Ram struct {
+	mu     sync.RWMutex
 	tables map[string]*table
+	closed bool
 }
 
 // New takes a map of maps with seed data
@@ -20,8 +26,26 @@ func New(seedData map[string]map[int]string) (*Ram, error) {
 	return &ram, nil
 }
 
-// Close closes the datastore.
+// Batch takes the names of some tables and a function that changes
+// them, and calls the function.  Nothing a Ram holds outlives the
+// process, so there is no crash to make the changes atomic against.
+func (ram *Ram) Batch(tableNames []string, fn func() error) error {
+	for _, tableName := range tableNames {
+		if _, err := ram.getTable(tableName); err != nil {
+			return err
+		}
+	}
+
+	return fn()
+}
+
+// Close closes the datastore.  Once it is closed, its methods return
+// dberr.ErrClosed, and calling Close again does nothing.
 func (ram *Ram) Close() error {
+	ram.mu.Lock()
+	defer ram.mu.Unlock()
+
+	ram.closed = true
 	ram.tables = nil
 
 	return nil
@@ -30,7 +54,14 @@ func (ram *Ram) Close() error {
 // CreateTable takes a table name, creates a new table
 // and adds it to the map of tables in the datastore.
 func (ram *Ram) CreateTable(tableName string) error {
-	if ram.TableExists(tableName) {
+	ram.mu.Lock()
+	defer ram.mu.Unlock()
+
+	if ram.closed {
+		return dberr.ErrClosed
+	}
+
+	if _, ok := ram.tables[tableName]; ok {
 		return dberr.ErrTableExists
 	}
 
@@ -54,6 +85,23 @@ func (ram *Ram) DeleteRec(tableName string, id int) error {
 	return nil
 }
 
+// DeleteKeyedRec takes a table name and a record key and deletes the
+// associated record.
+func (ram *Ram) DeleteKeyedRec(tableName string, key string) error {
+	table, err := ram.getTable(tableName)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := table.keyed[key]; !ok {
+		return dberr.ErrNoRecord
+	}
+
+	delete(table.keyed, key)
+
+	return nil
+}
+
 // GetLastID takes a table name and returns the greatest record
 // id found in the table.
 func (ram *Ram) GetLastID(tableName string) (int, error) {
@@ -93,6 +141,67 @@ func (ram *Ram) InsertRec(tableName string, id int, rec []byte) error {
 	return nil
 }
 
+// InsertKeyedRec takes a table name, a record key, and a byte array and
+// adds the record to the table.
+func (ram *Ram) InsertKeyedRec(tableName string, key string, rec []byte) error {
+	table, err := ram.getTable(tableName)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := table.keyed[key]; ok {
+		return dberr.ErrIDExists
+	}
+
+	table.keyed[key] = rec
+
+	return nil
+}
+
+// Keys takes a table name and returns an array of all record keys
+// found in the table.
+func (ram *Ram) Keys(tableName string) ([]string, error) {
+	table, err := ram.getTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(table.keyed))
+	for key := range table.keyed {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// NextID takes a table name, advances the table's id sequence and
+// returns its new value.  The sequence lasts as long as the table, so
+// ids of deleted records are not handed out again.
+func (ram *Ram) NextID(tableName string) (int, error) {
+	table, err := ram.getTable(tableName)
+	if err != nil {
+		return 0, err
+	}
+
+	return table.nextID(), nil
+}
+
+// ReadKeyedRec takes a table name and a key, reads the record from the
+// table, and returns a populated byte array.
+func (ram *Ram) ReadKeyedRec(tableName string, key string) ([]byte, error) {
+	table, err := ram.getTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	rec, ok := table.keyed[key]
+	if !ok {
+		return nil, dberr.ErrNoRecord
+	}
+
+	return rec, nil
+}
+
 // ReadRec takes a table name and an id, reads the record from the
 // table, and returns a populated byte array.
 func (ram *Ram) ReadRec(tableName string, id int) ([]byte, error) {
@@ -112,7 +221,14 @@ func (ram *Ram) ReadRec(tableName string, id int) ([]byte, error) {
 // RemoveTable takes a table name and deletes that table from the
 // datastore.
 func (ram *Ram) RemoveTable(tableName string) error {
-	if !ram.TableExists(tableName) {
+	ram.mu.Lock()
+	defer ram.mu.Unlock()
+
+	if ram.closed {
+		return dberr.ErrClosed
+	}
+
+	if _, ok := ram.tables[tableName]; !ok {
 		return dberr.ErrNoTable
 	}
 
@@ -121,9 +237,46 @@ func (ram *Ram) RemoveTable(tableName string) error {
 	return nil
 }
 
+// Scan takes a table name and calls fn with the id and the raw record
+// of every record in the table, in no particular order.
+func (ram *Ram) Scan(tableName string, fn func(id int, rec []byte) error) error {
+	table, err := ram.getTable(tableName)
+	if err != nil {
+		return err
+	}
+
+	for id, rec := range table.records {
+		if err := fn(id, rec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Snapshot takes a table name and returns a copy of every record in the
+// table, keyed by record id.
+func (ram *Ram) Snapshot(tableName string) (map[int][]byte, error) {
+	table, err := ram.getTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	recs := make(map[int][]byte, len(table.records))
+
+	for id, rec := range table.records {
+		recs[id] = append([]byte(nil), rec...)
+	}
+
+	return recs, nil
+}
+
 // TableExists takes a table name and returns a bool indicating
 // whether or not the table exists in the datastore.
 func (ram *Ram) TableExists(tableName string) bool {
+	ram.mu.RLock()
+	defer ram.mu.RUnlock()
+
 	_, ok := ram.tables[tableName]
 
 	return ok
@@ -131,6 +284,9 @@ func (ram *Ram) TableExists(tableName string) bool {
 
 // TableNames returns an array of table names.
 func (ram *Ram) TableNames() []string {
+	ram.mu.RLock()
+	defer ram.mu.RUnlock()
+
 	var names []string
 
 	for k := range ram.tables {
@@ -140,6 +296,23 @@ func (ram *Ram) TableNames() []string {
 	return names
 }
 
+// UpdateKeyedRec takes a table name, a record key, and a byte array and
+// updates the table record with that key.
+func (ram *Ram) UpdateKeyedRec(tableName string, key string, rec []byte) error {
+	table, err := ram.getTable(tableName)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := table.keyed[key]; !ok {
+		return dberr.ErrNoRecord
+	}
+
+	table.keyed[key] = rec
+
+	return nil
+}
+
 // UpdateRec takes a table name, a record id, and a byte array and updates
 // the table record with that id.
 func (ram *Ram) UpdateRec(tableName string, id int, rec []byte) error {
@@ -162,6 +335,13 @@ func (ram *Ram) UpdateRec(tableName string, id int, rec []byte) error {
 //******************************************************************************
 
 func (ram *Ram) getTable(tableName string) (*table, error) {
+	ram.mu.RLock()
+	defer ram.mu.RUnlock()
+
+	if ram.closed {
+		return nil, dberr.ErrClosed
+	}
+
 	table, ok := ram.tables[tableName]
 	if !ok {
 		return nil, dberr.ErrNoTable
@@ -171,6 +351,9 @@ func (ram *Ram) getTable(tableName string) (*table, error) {
 }
 
 func (ram *Ram) getTables() ([]string, error) {
+	ram.mu.RLock()
+	defer ram.mu.RUnlock()
+
 	var tableNames []string
 
 	for name := range ram.tables {
@@ -35,7 +35,7 @@ func TestNewCloseRamTests(t *testing.T) {
 			ram := newTestRam(t)
 			ram.Close()
 
-			wantErr := dberr.ErrNoTable
+			wantErr := dberr.ErrClosed
 			_, gotErr := ram.ReadRec("contacts", 3)
 
 			if !errors.Is(gotErr, wantErr) {
@@ -353,6 +353,66 @@ func TestRemoveTableRamTests(t *testing.T) {
 	runTestFns(t, tests)
 }
 
+func TestScanRamTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//Scan...
+
+			ram := newTestRam(t)
+			defer ram.Close()
+
+			got := make(map[int]string)
+			err := ram.Scan("contacts", func(id int, rec []byte) error {
+				got[id] = string(rec)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := seedData()
+
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+		func(t *testing.T) {
+			//Scan (NoTable error)...
+
+			ram := newTestRam(t)
+			defer ram.Close()
+
+			wantErr := dberr.ErrNoTable
+			gotErr := ram.Scan("nonexistent", func(id int, rec []byte) error { return nil })
+
+			if !errors.Is(gotErr, wantErr) {
+				t.Errorf("want %v; got %v", wantErr, gotErr)
+			}
+		},
+		func(t *testing.T) {
+			//Snapshot...
+
+			ram := newTestRam(t)
+			defer ram.Close()
+
+			got, err := ram.Snapshot("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got[3][0] = 'X'
+
+			want := `{"id":3,"first_name":"Bill","last_name":"Shakespeare","age":18}`
+
+			if want != string(ram.tables["contacts"].records[3]) {
+				t.Errorf("want %v; got %s", want, ram.tables["contacts"].records[3])
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
 func TestTableExistsRamTests(t *testing.T) {
 	var tests = []func(t *testing.T){
 		func(t *testing.T) {
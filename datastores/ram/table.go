@@ -4,12 +4,15 @@ import "github.com/jameycribbs/hare/dberr"
 
 type table struct {
 	records map[int][]byte
+	keyed   map[string][]byte
+	seq     int
 }
 
 func newTable() *table {
 	var t table
 
 	t.records = make(map[int][]byte)
+	t.keyed = make(map[string][]byte)
 
 	return &t
 }
@@ -36,6 +39,14 @@ func (t *table) getLastID() int {
 	return lastID
 }
 
+// nextID advances the table's sequence, which is kept at or above every
+// id written to the table, and returns its new value.
+func (t *table) nextID() int {
+	t.seq++
+
+	return t.seq
+}
+
 func (t *table) ids() []int {
 	ids := make([]int, len(t.records))
 
@@ -65,4 +76,8 @@ func (t *table) recExists(id int) bool {
 
 func (t *table) writeRec(id int, rec []byte) {
 	t.records[id] = rec
+
+	if id > t.seq {
+		t.seq = id
+	}
 }
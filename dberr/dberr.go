@@ -1,17 +1,144 @@
 package dberr
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 var (
-	// ErrIDExists error means a record with the specified id already exists in the table.
+	// ErrIndexExists error means an index on the specified field already exists on the table.
+	ErrIndexExists = errors.New("hare: index on that field already exists")
+
+	// ErrIDExists error means a record with the specified id, or key, already exists in the table.
 	ErrIDExists = errors.New("hare: record with that id already exists")
 
-	// ErrNoRecord error means no record with the specified id was not found.
+	// ErrNoRecord error means no record with the specified id, or key, was found.
 	ErrNoRecord = errors.New("hare: no record with that id found")
 
+	// ErrNoKey error means a record has no key and its table has no way to generate one.
+	ErrNoKey = errors.New("hare: record has no key")
+
+	// ErrNoIndex error means no index on the specified field exists on the table.
+	ErrNoIndex = errors.New("hare: no index on that field exists")
+
 	// ErrNoTable error means a table that the specified name does not exist.
 	ErrNoTable = errors.New("hare: table with that name does not exist")
 
+	// ErrUnique error means a record would break a unique constraint on the table.
+	ErrUnique = errors.New("hare: unique constraint violated")
+
+	// ErrTxDone error means the transaction has already been committed or rolled back.
+	ErrTxDone = errors.New("hare: transaction has already been committed or rolled back")
+
+	// ErrNotSupported error means the datastore does not support the requested feature.
+	ErrNotSupported = errors.New("hare: datastore does not support that feature")
+
+	// ErrLocked error means the database is already locked by another user of it.
+	ErrLocked = errors.New("hare: database is already locked")
+
+	// ErrReadOnly error means the database was opened for reading only.
+	ErrReadOnly = errors.New("hare: database was opened read-only")
+
+	// ErrClosed error means the database, or datastore, has been closed.
+	ErrClosed = errors.New("hare: database is closed")
+
+	// ErrCorrupt error means a line of a table file could not be read as a record.
+	ErrCorrupt = errors.New("hare: table file is corrupt")
+
+	// ErrBadRecord error means an encoded record is empty, starts like a dummy record or holds a newline, so the datastore can't store it.
+	ErrBadRecord = errors.New("hare: encoded record can't be stored on a line of its own")
+
+	// ErrRollback error means a failed transaction's applied changes could not all be reversed.
+	ErrRollback = errors.New("hare: transaction could not be fully rolled back")
+
 	// ErrTableExists error means a table with the specified name already exists in the database.
 	ErrTableExists = errors.New("hare: table with that name already exists")
 )
+
+// UniqueError is the error returned when a record would break a unique
+// constraint.  It matches ErrUnique when checked with errors.Is.
+type UniqueError struct {
+	// Table is the name of the table with the constraint.
+	Table string
+	// Field is the constrained field, or the comma-separated fields
+	// of a combination.
+	Field string
+	// ID is the id of the record that already holds the value.
+	ID int
+}
+
+func (e *UniqueError) Error() string {
+	return fmt.Sprintf("hare: unique constraint on %s.%s violated by record %d", e.Table, e.Field, e.ID)
+}
+
+// Unwrap returns ErrUnique.
+func (e *UniqueError) Unwrap() error {
+	return ErrUnique
+}
+
+// Error is the error returned by the methods of Database and the types
+// built on it.  It records what was being done when Err happened, and
+// matches Err, and so the sentinel errors, when checked with errors.Is.
+type Error struct {
+	// Op is the name of the method that failed, such as "Find".
+	Op string
+	// Table is the name of the table, if the method was given one.
+	Table string
+	// ID is the id of the record, if the method was given one.
+	ID int
+	// Key is the key of the record, for tables with string keys.
+	Key string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+
+	b.WriteString(e.Op)
+
+	if e.Table != "" {
+		b.WriteString(" " + e.Table)
+	}
+
+	if e.Key != "" {
+		b.WriteString(" record " + e.Key)
+	} else if e.ID != 0 {
+		b.WriteString(" record " + strconv.Itoa(e.ID))
+	}
+
+	return b.String() + ": " + e.Err.Error()
+}
+
+// Unwrap returns Err.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// CorruptError is the error returned when a line of a table file can't
+// be read as a record.  It matches ErrCorrupt when checked with
+// errors.Is, as well as Err.
+type CorruptError struct {
+	// Table is the name of the table.
+	Table string
+	// Offset is where the line starts in the table file.
+	Offset int64
+	// Err is the error from decoding the line.
+	Err error
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("hare: corrupt record in table %s at offset %d: %v", e.Table, e.Offset, e.Err)
+}
+
+// Is reports whether target is ErrCorrupt.
+func (e *CorruptError) Is(target error) bool {
+	return target == ErrCorrupt
+}
+
+// Unwrap returns Err.
+func (e *CorruptError) Unwrap() error {
+	return e.Err
+}
@@ -22,9 +22,19 @@ func main() {
 	}
 	defer db.Close()
 
+	// Index the comments table's episode_id field, so that looking up
+	// an episode's comments in its AfterFind doesn't scan the whole table.
+	if err := db.CreateIndex("comments", "episode_id"); err != nil {
+		panic(err)
+	}
+
+	// A typed handle saves having to pass the table name and
+	// to write query boilerplate for each model.
+	episodes := hare.NewTable[models.Episode](db, "episodes")
+
 	//----- CREATE -----
 
-	recID, err := db.Insert("episodes", &models.Episode{
+	recID, err := episodes.Insert(&models.Episode{
 		Season:           6,
 		Episode:          19,
 		Film:             "Red Zone Cuba",
@@ -42,9 +52,7 @@ func main() {
 
 	//----- READ -----
 
-	rec := models.Episode{}
-
-	err = db.Find("episodes", 4, &rec)
+	rec, err := episodes.Find(4)
 	if err != nil {
 		panic(err)
 	}
@@ -56,26 +64,26 @@ func main() {
 	//----- UPDATE -----
 
 	rec.Film = "The Skydivers - The Final Cut"
-	if err = db.Update("episodes", &rec); err != nil {
+	if err = episodes.Update(rec); err != nil {
 		panic(err)
 	}
 
 	//----- DELETE -----
 
-	err = db.Delete("episodes", 2)
+	err = episodes.Delete(2)
 	if err != nil {
 		panic(err)
 	}
 
 	//----- QUERYING -----
 
-	results, err := models.QueryEpisodes(db, func(r models.Episode) bool {
+	results, err := episodes.Where(func(r models.Episode) bool {
 		// Notice that we are taking advantage of the
 		// code we put in the Episode AfterFind method
 		// to be able to do the query by the associated
 		// host's name.
 		return r.Host.Name == "Joel"
-	}, 0)
+	})
 	if err != nil {
 		panic(err)
 	}
@@ -1,3 +1,5 @@
+//go:build unix
+
 package main
 
 import (
@@ -5,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"syscall"
 )
 
 // This is an example of a script you could
@@ -12,12 +15,30 @@ import (
 
 // IMPORTANT!!!  Before running this script or
 // one like it that you write, make sure no
-// processes are using the database!!!
+// processes are using the database!!!  The
+// script takes the same lock on the "hare.lock"
+// file that Hare's disk datastore takes, so it
+// stops if the database is open.  If a process
+// crashed, open and close the database with
+// Hare first, so that the changes left in the
+// write-ahead logs (the ".wal" files) are made,
+// and an unfinished transaction left in the
+// "hare.txlog" file is rolled back.
 
 const dirPath = "./data/"
 const tblExt = ".json"
 
 func main() {
+	lockFile, err := os.OpenFile(dirPath+"hare.lock", os.O_CREATE|os.O_RDWR, 0660)
+	if err != nil {
+		panic(err)
+	}
+	defer lockFile.Close()
+
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		panic("database is in use: " + err.Error())
+	}
+
 	files, err := ioutil.ReadDir(dirPath)
 	if err != nil {
 		panic(err)
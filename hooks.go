@@ -0,0 +1,129 @@
+package hare
+
+// AfterFinder is implemented by records that need to do something each
+// time they are read, like populating associations.  AfterFind is
+// called after the record has been decoded and the table's read lock
+// released, so it can read other tables.
+type AfterFinder interface {
+	AfterFind(*Database) error
+}
+
+// BeforeInserter is implemented by records that need to do something
+// before they are inserted, like validating or filling in fields.  An
+// error returned by BeforeInsert aborts the insert.
+type BeforeInserter interface {
+	BeforeInsert(*Database) error
+}
+
+// AfterInserter is implemented by records that need to do something
+// after they have been inserted.
+type AfterInserter interface {
+	AfterInsert(*Database) error
+}
+
+// BeforeUpdater is implemented by records that need to do something
+// before they are updated.  An error returned by BeforeUpdate aborts
+// the update.
+type BeforeUpdater interface {
+	BeforeUpdate(*Database) error
+}
+
+// AfterUpdater is implemented by records that need to do something
+// after they have been updated.
+type AfterUpdater interface {
+	AfterUpdate(*Database) error
+}
+
+// BeforeDeleter is implemented by records that need to do something
+// before they are deleted.  An error returned by BeforeDelete aborts
+// the delete.
+type BeforeDeleter interface {
+	BeforeDelete(*Database) error
+}
+
+// AfterDeleter is implemented by records that need to do something
+// after they have been deleted.
+type AfterDeleter interface {
+	AfterDelete(*Database) error
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+// The hook helpers take an interface{}, as both Records and
+// KeyedRecords may implement the hook interfaces.
+
+// deleteWithHooks takes a table name, a record id and an empty record
+// of the table's type.  If the record has delete hooks, it is found
+// first so that they can be run on it.
+func (db *Database) deleteWithHooks(tableName string, id int, rec Record) error {
+	_, hasBefore := rec.(BeforeDeleter)
+	_, hasAfter := rec.(AfterDeleter)
+
+	if !hasBefore && !hasAfter {
+		return db.Delete(tableName, id)
+	}
+
+	if err := db.Find(tableName, id, rec); err != nil {
+		return err
+	}
+
+	return db.DeleteRecord(tableName, rec)
+}
+
+func (db *Database) afterFind(rec interface{}) error {
+	if h, ok := rec.(AfterFinder); ok {
+		return h.AfterFind(db)
+	}
+
+	return nil
+}
+
+func (db *Database) beforeInsert(rec interface{}) error {
+	if h, ok := rec.(BeforeInserter); ok {
+		return h.BeforeInsert(db)
+	}
+
+	return nil
+}
+
+func (db *Database) afterInsert(rec interface{}) error {
+	if h, ok := rec.(AfterInserter); ok {
+		return h.AfterInsert(db)
+	}
+
+	return nil
+}
+
+func (db *Database) beforeUpdate(rec interface{}) error {
+	if h, ok := rec.(BeforeUpdater); ok {
+		return h.BeforeUpdate(db)
+	}
+
+	return nil
+}
+
+func (db *Database) afterUpdate(rec interface{}) error {
+	if h, ok := rec.(AfterUpdater); ok {
+		return h.AfterUpdate(db)
+	}
+
+	return nil
+}
+
+func (db *Database) beforeDelete(rec interface{}) error {
+	if h, ok := rec.(BeforeDeleter); ok {
+		return h.BeforeDelete(db)
+	}
+
+	return nil
+}
+
+func (db *Database) afterDelete(rec interface{}) error {
+	if h, ok := rec.(AfterDeleter); ok {
+		return h.AfterDelete(db)
+	}
+
+	return nil
+}
@@ -0,0 +1,399 @@
+package hare
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+var errNoLastName = errors.New("contact needs a last name")
+
+// hookedContact is a Contact that implements every hook and records the
+// order they are called in.
+type hookedContact struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Age       int    `json:"age"`
+	calls     *[]string
+}
+
+func (c *hookedContact) GetID() int {
+	return c.ID
+}
+
+func (c *hookedContact) SetID(id int) {
+	c.ID = id
+}
+
+func (c *hookedContact) record(call string) {
+	if c.calls != nil {
+		*c.calls = append(*c.calls, call)
+	}
+}
+
+func (c *hookedContact) AfterFind(db *Database) error {
+	c.record("AfterFind")
+	return nil
+}
+
+func (c *hookedContact) BeforeInsert(db *Database) error {
+	c.record("BeforeInsert")
+
+	if c.LastName == "" {
+		return errNoLastName
+	}
+
+	return nil
+}
+
+func (c *hookedContact) AfterInsert(db *Database) error {
+	c.record("AfterInsert")
+	return nil
+}
+
+func (c *hookedContact) BeforeUpdate(db *Database) error {
+	c.record("BeforeUpdate")
+
+	if c.LastName == "" {
+		return errNoLastName
+	}
+
+	return nil
+}
+
+func (c *hookedContact) AfterUpdate(db *Database) error {
+	c.record("AfterUpdate")
+
+	// After hooks run once the table is unlocked, so they may use it.
+	return db.Find("contacts", c.ID, &Contact{})
+}
+
+func (c *hookedContact) BeforeDelete(db *Database) error {
+	c.record("BeforeDelete")
+
+	if c.Age < 21 {
+		return errors.New("contact is too young to delete")
+	}
+
+	return nil
+}
+
+func (c *hookedContact) AfterDelete(db *Database) error {
+	c.record("AfterDelete")
+	return nil
+}
+
+// plainContact implements none of the hooks.
+type plainContact struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"first_name"`
+}
+
+func (c *plainContact) GetID() int {
+	return c.ID
+}
+
+func (c *plainContact) SetID(id int) {
+	c.ID = id
+}
+
+// crossContact reads another table from its AfterFind hook.
+type crossContact struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"first_name"`
+}
+
+func (c *crossContact) GetID() int {
+	return c.ID
+}
+
+func (c *crossContact) SetID(id int) {
+	c.ID = id
+}
+
+func (c *crossContact) AfterFind(db *Database) error {
+	return db.Find("contacts", 1, &Contact{})
+}
+
+func TestHookTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//Insert and Update hooks...
+
+			return func(t *testing.T) {
+				var calls []string
+
+				c := hookedContact{FirstName: "Jane", LastName: "Roe", calls: &calls}
+
+				id, err := db.Insert("contacts", &c)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				c.Age = 30
+				if err := db.Update("contacts", &c); err != nil {
+					t.Fatal(err)
+				}
+
+				want := []string{"BeforeInsert", "AfterInsert", "BeforeUpdate", "AfterUpdate"}
+				if !reflect.DeepEqual(want, calls) {
+					t.Errorf("want %v; got %v", want, calls)
+				}
+
+				found := hookedContact{calls: &calls}
+				if err := db.Find("contacts", id, &found); err != nil {
+					t.Fatal(err)
+				}
+
+				wantCall := "AfterFind"
+				gotCall := calls[len(calls)-1]
+				if wantCall != gotCall {
+					t.Errorf("want %v; got %v", wantCall, gotCall)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Before hooks abort...
+
+			return func(t *testing.T) {
+				_, err := db.Insert("contacts", &hookedContact{FirstName: "Jane"})
+				checkErr(t, errNoLastName, err)
+
+				want := 4
+				got := db.lastIDs["contacts"]
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				checkErr(t, errNoLastName, db.Update("contacts", &hookedContact{ID: 1, FirstName: "John"}))
+
+				c := Contact{}
+				if err := db.Find("contacts", 1, &c); err != nil {
+					t.Fatal(err)
+				}
+
+				wantName := "Doe"
+				gotName := c.LastName
+				if wantName != gotName {
+					t.Errorf("want %v; got %v", wantName, gotName)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Table.Delete hooks...
+
+			return func(t *testing.T) {
+				contacts := NewTable[hookedContact](db, "contacts")
+
+				// Bill Shakespeare is 18.
+				if err := contacts.Delete(3); err == nil {
+					t.Errorf("want %v; got %v", "error", err)
+				}
+
+				if _, err := contacts.Find(3); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := contacts.Delete(1); err != nil {
+					t.Fatal(err)
+				}
+
+				_, err := contacts.Find(1)
+				checkErr(t, dberr.ErrNoRecord, err)
+
+				checkErr(t, dberr.ErrNoRecord, contacts.Delete(1))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//DeleteRecord hooks...
+
+			return func(t *testing.T) {
+				var calls []string
+
+				young := hookedContact{calls: &calls}
+				if err := db.Find("contacts", 3, &young); err != nil {
+					t.Fatal(err)
+				}
+
+				// Bill Shakespeare is 18.
+				if err := db.DeleteRecord("contacts", &young); err == nil {
+					t.Errorf("want %v; got %v", "error", err)
+				}
+
+				if err := db.Find("contacts", 3, &Contact{}); err != nil {
+					t.Fatal(err)
+				}
+
+				old := hookedContact{calls: &calls}
+				if err := db.Find("contacts", 1, &old); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.DeleteRecord("contacts", &old); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrNoRecord, db.Find("contacts", 1, &Contact{}))
+
+				want := []string{"AfterFind", "BeforeDelete", "AfterFind", "BeforeDelete", "AfterDelete"}
+				if !reflect.DeepEqual(want, calls) {
+					t.Errorf("want %v; got %v", want, calls)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Tx hooks...
+
+			return func(t *testing.T) {
+				var calls []string
+
+				tx := db.Begin()
+
+				_, err := tx.Insert("contacts", &hookedContact{FirstName: "Jane", calls: &calls})
+				checkErr(t, errNoLastName, err)
+
+				if _, err := tx.Insert("contacts", &hookedContact{FirstName: "Jane", LastName: "Roe", calls: &calls}); err != nil {
+					t.Fatal(err)
+				}
+
+				want := []string{"BeforeInsert", "BeforeInsert"}
+				if !reflect.DeepEqual(want, calls) {
+					t.Errorf("want %v; got %v", want, calls)
+				}
+
+				if err := tx.Commit(); err != nil {
+					t.Fatal(err)
+				}
+
+				want = append(want, "AfterInsert")
+				if !reflect.DeepEqual(want, calls) {
+					t.Errorf("want %v; got %v", want, calls)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Tx delete hooks...
+
+			return func(t *testing.T) {
+				var calls []string
+
+				tx := db.Begin()
+
+				// Bill Shakespeare is 18.
+				if err := tx.DeleteRecord("contacts", &hookedContact{ID: 3, Age: 18, calls: &calls}); err == nil {
+					t.Errorf("want %v; got %v", "error", err)
+				}
+
+				if err := tx.DeleteRecord("contacts", &hookedContact{ID: 1, Age: 37, calls: &calls}); err != nil {
+					t.Fatal(err)
+				}
+
+				want := []string{"BeforeDelete", "BeforeDelete"}
+				if !reflect.DeepEqual(want, calls) {
+					t.Errorf("want %v; got %v", want, calls)
+				}
+
+				if err := tx.Commit(); err != nil {
+					t.Fatal(err)
+				}
+
+				want = append(want, "AfterDelete")
+				if !reflect.DeepEqual(want, calls) {
+					t.Errorf("want %v; got %v", want, calls)
+				}
+
+				checkErr(t, dberr.ErrNoRecord, db.Find("contacts", 1, &Contact{}))
+
+				if err := db.Find("contacts", 3, &Contact{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//AfterFind reading another table during Commit...
+
+			return func(t *testing.T) {
+				if err := db.CreateTable("newtable"); err != nil {
+					t.Fatal(err)
+				}
+
+				id, err := db.Insert("newtable", &crossContact{FirstName: "Rex"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				done := make(chan error, 2)
+
+				go func() {
+					for i := 0; i < 200; i++ {
+						if err := db.Find("newtable", id, &crossContact{}); err != nil {
+							done <- err
+							return
+						}
+					}
+					done <- nil
+				}()
+
+				go func() {
+					for i := 0; i < 200; i++ {
+						tx := db.Begin()
+
+						if err := tx.Update("contacts", &Contact{ID: 1, FirstName: "John", LastName: "Doe", Age: i}); err != nil {
+							done <- err
+							return
+						}
+
+						if err := tx.Update("newtable", &crossContact{ID: id, FirstName: "Rex"}); err != nil {
+							done <- err
+							return
+						}
+
+						if err := tx.Commit(); err != nil {
+							done <- err
+							return
+						}
+					}
+					done <- nil
+				}()
+
+				for i := 0; i < 2; i++ {
+					select {
+					case err := <-done:
+						if err != nil {
+							t.Fatal(err)
+						}
+					case <-time.After(10 * time.Second):
+						t.Fatal("deadlocked")
+					}
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Record without hooks...
+
+			return func(t *testing.T) {
+				id, err := db.Insert("contacts", &plainContact{FirstName: "Jane"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				c, err := NewTable[plainContact](db, "contacts").Find(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := "Jane"
+				got := c.FirstName
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
@@ -0,0 +1,318 @@
+package hare
+
+import (
+	"sort"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// index is an in-memory secondary index on one JSON field of a table.
+// It maps each distinct scalar value of the field to the ids of the
+// records holding it, and keeps the distinct values sorted so that
+// range lookups are a binary search.  Records whose field holds an
+// array or object can't be ordered, so they are kept aside and always
+// returned as candidates.
+type index struct {
+	field  string
+	keys   []interface{}
+	ids    map[interface{}]map[int]struct{}
+	others map[int]struct{}
+}
+
+func newIndex(field string) *index {
+	return &index{
+		field:  field,
+		ids:    make(map[interface{}]map[int]struct{}),
+		others: make(map[int]struct{}),
+	}
+}
+
+// CreateIndex takes a table name and a JSON field name and builds a
+// secondary index on that field.  Queries with Eq, Lt, Le, Gt or Ge
+// predicates on the field use the index instead of scanning the whole
+// table.  Indexes are held in memory and need to be created each time
+// the database is opened.
+func (db *Database) CreateIndex(tableName string, field string) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "CreateIndex", Table: tableName})
+
+	if err := db.enter(); err != nil {
+		return err
+	}
+	defer db.exit()
+
+	if !db.hasTable(tableName) {
+		return dberr.ErrNoTable
+	}
+
+	if db.isKeyed(tableName) {
+		return dberr.ErrNotSupported
+	}
+
+	lock, err := db.lockTable(tableName)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if _, ok := db.tableIndexes(tableName)[field]; ok {
+		return dberr.ErrIndexExists
+	}
+
+	idx := newIndex(field)
+
+	err = db.scanTable(tableName, func(id int, rawRec []byte) error {
+		fields, err := db.decodeFields(tableName, rawRec)
+		if err != nil {
+			return err
+		}
+
+		idx.add(id, fields)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.indexes[tableName] == nil {
+		db.indexes[tableName] = make(map[string]*index)
+	}
+	db.indexes[tableName][field] = idx
+
+	return nil
+}
+
+// DropIndex takes a table name and a JSON field name and removes the
+// secondary index on that field.
+func (db *Database) DropIndex(tableName string, field string) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "DropIndex", Table: tableName})
+
+	if err := db.enter(); err != nil {
+		return err
+	}
+	defer db.exit()
+
+	lock, err := db.lockTable(tableName)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.indexes[tableName][field]; !ok {
+		return dberr.ErrNoIndex
+	}
+
+	delete(db.indexes[tableName], field)
+
+	return nil
+}
+
+// Indexes takes a table name and returns the fields that are indexed
+// on that table.
+func (db *Database) Indexes(tableName string) (_ []string, err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Indexes", Table: tableName})
+
+	if err := db.enter(); err != nil {
+		return nil, err
+	}
+	defer db.exit()
+
+	lock, err := db.rlockTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.RUnlock()
+
+	var fields []string
+	for field := range db.tableIndexes(tableName) {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	return fields, nil
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+func (idx *index) add(id int, fields map[string]interface{}) {
+	v := fieldValue(fields, idx.field)
+
+	if kindRank(v) == 4 {
+		idx.others[id] = struct{}{}
+		return
+	}
+
+	ids, ok := idx.ids[v]
+	if !ok {
+		ids = make(map[int]struct{})
+		idx.ids[v] = ids
+
+		i := idx.search(v)
+		idx.keys = append(idx.keys, nil)
+		copy(idx.keys[i+1:], idx.keys[i:])
+		idx.keys[i] = v
+	}
+
+	ids[id] = struct{}{}
+}
+
+func (idx *index) remove(id int, fields map[string]interface{}) {
+	v := fieldValue(fields, idx.field)
+
+	if kindRank(v) == 4 {
+		delete(idx.others, id)
+		return
+	}
+
+	ids, ok := idx.ids[v]
+	if !ok {
+		return
+	}
+
+	delete(ids, id)
+
+	if len(ids) == 0 {
+		delete(idx.ids, v)
+
+		i := idx.search(v)
+		idx.keys = append(idx.keys[:i], idx.keys[i+1:]...)
+	}
+}
+
+// lookup takes a predicate on the indexed field and returns, sorted,
+// the ids of the records that may satisfy it.
+func (idx *index) lookup(p Predicate) []int {
+	var lo, hi int
+
+	switch p.op {
+	case opEq:
+		lo = idx.search(p.value)
+		hi = idx.searchAfter(p.value)
+	case opLt:
+		lo, hi = 0, idx.search(p.value)
+	case opLe:
+		lo, hi = 0, idx.searchAfter(p.value)
+	case opGt:
+		lo, hi = idx.searchAfter(p.value), len(idx.keys)
+	case opGe:
+		lo, hi = idx.search(p.value), len(idx.keys)
+	}
+
+	var ids []int
+
+	for _, key := range idx.keys[lo:hi] {
+		for id := range idx.ids[key] {
+			ids = append(ids, id)
+		}
+	}
+
+	for id := range idx.others {
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+
+	return ids
+}
+
+// search returns the position of the first key not less than v.
+func (idx *index) search(v interface{}) int {
+	return sort.Search(len(idx.keys), func(i int) bool {
+		return compareValues(idx.keys[i], v) >= 0
+	})
+}
+
+// searchAfter returns the position of the first key greater than v.
+func (idx *index) searchAfter(v interface{}) int {
+	return sort.Search(len(idx.keys), func(i int) bool {
+		return compareValues(idx.keys[i], v) > 0
+	})
+}
+
+// indexFor takes a table name and normalized predicates and returns
+// the first predicate that can be answered by one of the table's
+// indexes, along with that index.
+func (db *Database) indexFor(tableName string, preds []Predicate) (*index, Predicate, bool) {
+	for _, p := range preds {
+		if p.op == opFunc || p.op == opNe || kindRank(p.value) == 4 {
+			continue
+		}
+
+		if idx, ok := db.tableIndexes(tableName)[p.field]; ok {
+			return idx, p, true
+		}
+	}
+
+	return nil, Predicate{}, false
+}
+
+// indexedFields takes a table name and a record id and, if the table
+// has any indexes or unique constraints, returns the record's decoded
+// JSON fields as they are currently stored, so they can later be passed
+// to updateIndexes.
+func (db *Database) indexedFields(tableName string, id int) (map[string]interface{}, error) {
+	if !db.isIndexed(tableName) {
+		return nil, nil
+	}
+
+	return db.readFields(tableName, id)
+}
+
+// decodeIndexed takes a table name and a raw record and, if the table
+// has any indexes or unique constraints, returns the record's decoded
+// JSON fields.
+func (db *Database) decodeIndexed(tableName string, rawRec []byte) (map[string]interface{}, error) {
+	if !db.isIndexed(tableName) {
+		return nil, nil
+	}
+
+	return db.decodeFields(tableName, rawRec)
+}
+
+func (db *Database) isIndexed(tableName string) bool {
+	return len(db.tableIndexes(tableName)) > 0 || len(db.tableUniques(tableName)) > 0
+}
+
+// updateIndexes takes a table name, a record id, the record's old
+// fields (nil for a new record) and its new fields (nil for a deleted
+// record) and brings every index and unique constraint on the table up
+// to date.
+func (db *Database) updateIndexes(tableName string, id int, oldFields map[string]interface{}, newFields map[string]interface{}) {
+	for _, idx := range db.tableIndexes(tableName) {
+		if oldFields != nil {
+			idx.remove(id, oldFields)
+		}
+		if newFields != nil {
+			idx.add(id, newFields)
+		}
+	}
+
+	for _, u := range db.tableUniques(tableName) {
+		if oldFields != nil {
+			u.remove(id, oldFields)
+		}
+		if newFields != nil {
+			u.add(id, newFields)
+		}
+	}
+}
+
+// readFields reads a record from the datastore and returns its
+// decoded JSON fields.
+func (db *Database) readFields(tableName string, id int) (map[string]interface{}, error) {
+	rawRec, err := db.store.ReadRec(tableName, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.decodeFields(tableName, rawRec)
+}
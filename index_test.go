@@ -0,0 +1,163 @@
+package hare
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestIndexTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//CreateIndex...
+
+			return func(t *testing.T) {
+				if err := db.CreateIndex("contacts", "age"); err != nil {
+					t.Fatal(err)
+				}
+
+				want := []string{"age"}
+				got, err := db.Indexes("contacts")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				wantIDs := []int{3, 4, 1, 2}
+				var gotIDs []int
+				for _, key := range db.indexes["contacts"]["age"].keys {
+					for id := range db.indexes["contacts"]["age"].ids[key] {
+						gotIDs = append(gotIDs, id)
+					}
+				}
+
+				if !reflect.DeepEqual(wantIDs, gotIDs) {
+					t.Errorf("want %v; got %v", wantIDs, gotIDs)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//CreateIndex (IndexExists error)...
+
+			return func(t *testing.T) {
+				if err := db.CreateIndex("contacts", "age"); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrIndexExists, db.CreateIndex("contacts", "age"))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//CreateIndex (NoTable error)...
+
+			return func(t *testing.T) {
+				checkErr(t, dberr.ErrNoTable, db.CreateIndex("nonexistent", "age"))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//DropIndex...
+
+			return func(t *testing.T) {
+				if err := db.CreateIndex("contacts", "age"); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.DropIndex("contacts", "age"); err != nil {
+					t.Fatal(err)
+				}
+
+				got, err := db.Indexes("contacts")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(got) != 0 {
+					t.Errorf("want %v; got %v", nil, got)
+				}
+
+				checkErr(t, dberr.ErrNoIndex, db.DropIndex("contacts", "age"))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Query using an index...
+
+			return func(t *testing.T) {
+				if err := db.CreateIndex("contacts", "age"); err != nil {
+					t.Fatal(err)
+				}
+
+				tests := []struct {
+					preds []Predicate
+					want  []int
+				}{
+					{[]Predicate{Eq("age", 52)}, []int{2}},
+					{[]Predicate{Eq("age", 53)}, nil},
+					{[]Predicate{Lt("age", 25)}, []int{3}},
+					{[]Predicate{Le("age", 25)}, []int{3, 4}},
+					{[]Predicate{Gt("age", 37)}, []int{2}},
+					{[]Predicate{Ge("age", 37)}, []int{1, 2}},
+					{[]Predicate{Ge("age", 20), Eq("first_name", "John")}, []int{1}},
+					{[]Predicate{Gt("age", "a")}, nil},
+				}
+
+				for _, tt := range tests {
+					got, err := db.Query("contacts").Where(tt.preds...).IDs()
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if !reflect.DeepEqual(tt.want, got) {
+						t.Errorf("want %v; got %v", tt.want, got)
+					}
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Index kept up to date by Insert, Update and Delete...
+
+			return func(t *testing.T) {
+				if err := db.CreateIndex("contacts", "last_name"); err != nil {
+					t.Fatal(err)
+				}
+
+				id, err := db.Insert("contacts", &Contact{FirstName: "Jane", LastName: "Doe", Age: 30})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.Update("contacts", &Contact{ID: 3, FirstName: "Bill", LastName: "Doe", Age: 18}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.Delete("contacts", 1); err != nil {
+					t.Fatal(err)
+				}
+
+				want := []int{3, id}
+				got, err := db.Query("contacts").Where(Eq("last_name", "Doe")).IDs()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				got, err = db.Query("contacts").Where(Eq("last_name", "Shakespeare")).IDs()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got != nil {
+					t.Errorf("want %v; got %v", nil, got)
+				}
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
@@ -0,0 +1,327 @@
+package hare
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// KeyedRecord interface defines the methods a struct representing a
+// record in a table with string keys must implement.  The key is stored
+// as the record's "id" field.
+type KeyedRecord interface {
+	SetKey(string)
+	GetKey() string
+}
+
+// KeyFunc generates a new key for a record in a table with string keys.
+type KeyFunc func() (string, error)
+
+// UUIDv4 is a KeyFunc that generates random version 4 UUIDs.
+var UUIDv4 KeyFunc = newUUIDv4
+
+// ULID is a KeyFunc that generates ULIDs, which sort in the order they
+// were generated, to the millisecond.
+var ULID KeyFunc = newULID
+
+// crockford is the alphabet ULIDs are encoded in.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// WithKeys takes a table name and a KeyFunc and returns an Option that
+// makes the table's records identified by string keys, rather than int
+// ids.  The KeyFunc generates a key for each record inserted without
+// one.  If it is nil, every record must be given its key by the caller.
+//
+// A table with string keys is used through InsertKeyed, FindKeyed,
+// UpdateKeyed, DeleteKeyed and Keys, and needs a datastore that
+// implements KeyedStore.  Queries, indexes, unique constraints and
+// transactions work on tables with int ids only.
+func WithKeys(tableName string, newKey KeyFunc) Option {
+	return func(db *Database) {
+		db.keyFuncs[tableName] = newKey
+	}
+}
+
+// DeleteKeyed takes a table name and a record key and removes that
+// record from the database.
+func (db *Database) DeleteKeyed(tableName string, key string) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "DeleteKeyed", Table: tableName, Key: key})
+
+	if err := db.enter(); err != nil {
+		return err
+	}
+	defer db.exit()
+
+	store, err := db.keyedStore(tableName)
+	if err != nil {
+		return err
+	}
+
+	lock, err := db.lockTable(tableName)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if err := store.DeleteKeyedRec(tableName, key); err != nil {
+		return err
+	}
+
+	db.emitKeyed(EventDelete, tableName, key, nil)
+
+	return nil
+}
+
+// FindKeyed takes a table name, a record key, and a pointer to a struct
+// that implements the KeyedRecord interface, finds the associated
+// record from the table, and populates the struct.
+func (db *Database) FindKeyed(tableName string, key string, rec KeyedRecord) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "FindKeyed", Table: tableName, Key: key})
+
+	if err := db.enter(); err != nil {
+		return err
+	}
+	defer db.exit()
+
+	store, err := db.keyedStore(tableName)
+	if err != nil {
+		return err
+	}
+
+	if err := db.readKeyedRec(store, tableName, key, rec); err != nil {
+		return err
+	}
+
+	// As in Find, the hook runs once the table's lock is released.
+	return db.afterFind(rec)
+}
+
+// InsertKeyed takes a table name and a struct that implements the
+// KeyedRecord interface and adds a new record to the table.  A record
+// without a key is given one by the table's KeyFunc.  It returns the
+// new record's key, or dberr.ErrNoKey if the record has none and the
+// table can't generate one.  Hooks are run as they are by Insert.
+func (db *Database) InsertKeyed(tableName string, rec KeyedRecord) (_ string, err error) {
+	defer wrapErr(&err, dberr.Error{Op: "InsertKeyed", Table: tableName})
+
+	if err := db.enter(); err != nil {
+		return "", err
+	}
+	defer db.exit()
+
+	store, err := db.keyedStore(tableName)
+	if err != nil {
+		return "", err
+	}
+
+	if err := db.beforeInsert(rec); err != nil {
+		return "", err
+	}
+
+	if rec.GetKey() == "" {
+		newKey := db.keyFuncs[tableName]
+		if newKey == nil {
+			return "", dberr.ErrNoKey
+		}
+
+		key, err := newKey()
+		if err != nil {
+			return "", err
+		}
+
+		rec.SetKey(key)
+	}
+
+	key := rec.GetKey()
+
+	if err := db.writeKeyed(tableName, key, rec, store.InsertKeyedRec, EventInsert); err != nil {
+		return "", err
+	}
+
+	return key, db.afterInsert(rec)
+}
+
+// Keys takes a table name and returns the keys of all of the records
+// in a table with string keys.
+func (db *Database) Keys(tableName string) (_ []string, err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Keys", Table: tableName})
+
+	if err := db.enter(); err != nil {
+		return nil, err
+	}
+	defer db.exit()
+
+	store, err := db.keyedStore(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := db.rlockTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.RUnlock()
+
+	return store.Keys(tableName)
+}
+
+// UpdateKeyed takes a table name and a struct that implements the
+// KeyedRecord interface and updates the record in the table that has
+// that record's key.  Hooks are run as they are by Update.
+func (db *Database) UpdateKeyed(tableName string, rec KeyedRecord) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "UpdateKeyed", Table: tableName, Key: rec.GetKey()})
+
+	if err := db.enter(); err != nil {
+		return err
+	}
+	defer db.exit()
+
+	store, err := db.keyedStore(tableName)
+	if err != nil {
+		return err
+	}
+
+	if err := db.beforeUpdate(rec); err != nil {
+		return err
+	}
+
+	if err := db.writeKeyed(tableName, rec.GetKey(), rec, store.UpdateKeyedRec, EventUpdate); err != nil {
+		return err
+	}
+
+	return db.afterUpdate(rec)
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+// isKeyed reports whether a table's records are identified by string
+// keys.
+func (db *Database) isKeyed(tableName string) bool {
+	_, ok := db.keyFuncs[tableName]
+
+	return ok
+}
+
+// checkIDTable returns dberr.ErrNoTable if a table doesn't exist, and
+// dberr.ErrNotSupported if its records are identified by string keys
+// rather than ids, so the two never get mixed up in one table.
+func (db *Database) checkIDTable(tableName string) error {
+	if !db.hasTable(tableName) {
+		return dberr.ErrNoTable
+	}
+
+	if db.isKeyed(tableName) {
+		return dberr.ErrNotSupported
+	}
+
+	return nil
+}
+
+// keyedStore returns the datastore as a KeyedStore, if the table exists
+// and has string keys and the datastore supports them.
+func (db *Database) keyedStore(tableName string) (KeyedStore, error) {
+	if !db.hasTable(tableName) {
+		return nil, dberr.ErrNoTable
+	}
+
+	store, ok := db.store.(KeyedStore)
+	if !ok || !db.isKeyed(tableName) {
+		return nil, dberr.ErrNotSupported
+	}
+
+	return store, nil
+}
+
+// readKeyedRec populates rec from a keyed table's record, under the
+// table's read lock.  It doesn't run rec's AfterFind hook.
+func (db *Database) readKeyedRec(store KeyedStore, tableName string, key string, rec KeyedRecord) error {
+	lock, err := db.rlockTable(tableName)
+	if err != nil {
+		return err
+	}
+	defer lock.RUnlock()
+
+	rawRec, err := store.ReadKeyedRec(tableName, key)
+	if err != nil {
+		return err
+	}
+
+	return db.codecFor(tableName).Unmarshal(rawRec, rec)
+}
+
+// writeKeyed encodes a record and writes it with the given datastore
+// method, holding the table's write lock.
+func (db *Database) writeKeyed(tableName string, key string, rec KeyedRecord, write func(string, string, []byte) error, kind EventKind) error {
+	lock, err := db.lockTable(tableName)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	rawRec, err := db.codecFor(tableName).Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	if err := write(tableName, key, rawRec); err != nil {
+		return err
+	}
+
+	db.emitKeyed(kind, tableName, key, rawRec)
+
+	return nil
+}
+
+func newUUIDv4() (string, error) {
+	var b [16]byte
+
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func newULID() (string, error) {
+	var b [16]byte
+
+	ms := uint64(time.Now().UnixMilli())
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+
+	// The 128 bits are encoded 5 at a time, most significant first,
+	// as if they had 2 leading zero bits.
+	bit := func(n int) byte {
+		if n >= 128 {
+			return 0
+		}
+		return b[15-n/8] >> (n % 8) & 1
+	}
+
+	var ulid [26]byte
+	for i := range ulid {
+		start := 125 - 5*i
+
+		var c byte
+		for k := 4; k >= 0; k-- {
+			c = c<<1 | bit(start+k)
+		}
+
+		ulid[i] = crockford[c]
+	}
+
+	return string(ulid[:]), nil
+}
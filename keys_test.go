@@ -0,0 +1,322 @@
+package hare
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/jameycribbs/hare/datastores/disk"
+	"github.com/jameycribbs/hare/datastores/ram"
+	"github.com/jameycribbs/hare/dberr"
+)
+
+type Device struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (d *Device) GetKey() string {
+	return d.ID
+}
+
+func (d *Device) SetKey(key string) {
+	d.ID = key
+}
+
+func TestKeyFuncTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//UUIDv4...
+
+			re := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+			key, err := UUIDv4()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !re.MatchString(key) {
+				t.Errorf("want %v; got %v", re, key)
+			}
+		},
+		func(t *testing.T) {
+			//ULID...
+
+			re := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+
+			var keys []string
+			for i := 0; i < 3; i++ {
+				key, err := ULID()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !re.MatchString(key) {
+					t.Errorf("want %v; got %v", re, key)
+				}
+
+				keys = append(keys, key)
+			}
+
+			// The first 10 characters hold the time, so they sort.
+			for i := 1; i < len(keys); i++ {
+				if keys[i][:10] < keys[i-1][:10] {
+					t.Errorf("want %v after %v", keys[i], keys[i-1])
+				}
+			}
+		},
+	}
+
+	for i, fn := range tests {
+		t.Run(strconv.Itoa(i), fn)
+	}
+}
+
+func TestKeyedTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//InsertKeyed, FindKeyed, UpdateKeyed, DeleteKeyed...
+
+			return func(t *testing.T) {
+				key, err := db.InsertKeyed("devices", &Device{Name: "laptop"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if _, err := db.InsertKeyed("devices", &Device{ID: "phone-1", Name: "phone"}); err != nil {
+					t.Fatal(err)
+				}
+
+				_, err = db.InsertKeyed("devices", &Device{ID: "phone-1", Name: "phone"})
+				checkErr(t, dberr.ErrIDExists, err)
+
+				d := Device{}
+				if err := db.FindKeyed("devices", key, &d); err != nil {
+					t.Fatal(err)
+				}
+
+				want := Device{ID: key, Name: "laptop"}
+				if want != d {
+					t.Errorf("want %v; got %v", want, d)
+				}
+
+				d.Name = "work laptop"
+				if err := db.UpdateKeyed("devices", &d); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.DeleteKeyed("devices", "phone-1"); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrNoRecord, db.FindKeyed("devices", "phone-1", &Device{}))
+
+				keys, err := db.Keys("devices")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				wantKeys := fmt.Sprint([]string{key})
+				gotKeys := fmt.Sprint(keys)
+				if wantKeys != gotKeys {
+					t.Errorf("want %v; got %v", wantKeys, gotKeys)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//InsertKeyed (NoKey error)...
+
+			return func(t *testing.T) {
+				_, err := db.InsertKeyed("phones", &Device{Name: "phone"})
+				checkErr(t, dberr.ErrNoKey, err)
+
+				key, err := db.InsertKeyed("phones", &Device{ID: "phone-1", Name: "phone"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := "phone-1"
+				if want != key {
+					t.Errorf("want %v; got %v", want, key)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Keyed tables (NotSupported errors)...
+
+			return func(t *testing.T) {
+				checkErr(t, dberr.ErrNotSupported, db.CreateIndex("devices", "name"))
+				checkErr(t, dberr.ErrNotSupported, db.CreateUnique("devices", "name"))
+
+				_, err := db.Query("devices").IDs()
+				checkErr(t, dberr.ErrNotSupported, err)
+
+				checkErr(t, dberr.ErrNotSupported, db.Begin().Delete("devices", 1))
+
+				_, err = db.Insert("devices", &Contact{})
+				checkErr(t, dberr.ErrNotSupported, err)
+
+				checkErr(t, dberr.ErrNotSupported, db.Find("devices", 1, &Contact{}))
+				checkErr(t, dberr.ErrNotSupported, db.Update("devices", &Contact{ID: 1}))
+				checkErr(t, dberr.ErrNotSupported, db.Delete("devices", 1))
+				checkErr(t, dberr.ErrNotSupported, db.DeleteRecord("devices", &Contact{ID: 1}))
+
+				_, err = db.IDs("devices")
+				checkErr(t, dberr.ErrNotSupported, err)
+
+				keys, err := db.Keys("devices")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(keys) != 0 {
+					t.Errorf("want %v; got %v", 0, keys)
+				}
+
+				_, err = db.InsertKeyed("contacts", &Device{ID: "a"})
+				checkErr(t, dberr.ErrNotSupported, err)
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Watch keyed table...
+
+			return func(t *testing.T) {
+				w, err := db.Watch("phones")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer w.Close()
+
+				if _, err := db.InsertKeyed("phones", &Device{ID: "phone-1", Name: "phone"}); err != nil {
+					t.Fatal(err)
+				}
+
+				event := <-w.Events()
+
+				want := `insert phone-1 {"id":"phone-1","name":"phone"}`
+				got := fmt.Sprintf("%v %v %s", event.Kind, event.Key, event.Rec)
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+	}
+
+	for i, fn := range tests {
+		tstNum := strconv.Itoa(i)
+
+		dir := t.TempDir()
+
+		diskDS, err := disk.New(dir, ".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run(fmt.Sprintf("disk/%s", tstNum), fn(newKeyedTestDB(t, diskDS)))
+
+		ramDS, err := ram.New(seedData())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run(fmt.Sprintf("ram/%s", tstNum), fn(newKeyedTestDB(t, ramDS)))
+	}
+}
+
+func TestKeyedDiskTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//Keyed records survive reopening and compaction...
+
+			dir := t.TempDir()
+
+			ds, err := disk.New(dir, ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db := newKeyedTestDB(t, ds)
+
+			var keys []string
+			for _, name := range []string{"laptop", "phone", "tablet"} {
+				key, err := db.InsertKeyed("devices", &Device{Name: name})
+				if err != nil {
+					t.Fatal(err)
+				}
+				keys = append(keys, key)
+			}
+
+			if err := db.UpdateKeyed("devices", &Device{ID: keys[0], Name: "a laptop with a much longer name"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := db.DeleteKeyed("devices", keys[1]); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := db.Compact("devices"); err != nil {
+				t.Fatal(err)
+			}
+
+			db.Close()
+
+			ds, err = disk.New(dir, ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db = newKeyedTestDB(t, ds)
+			defer db.Close()
+
+			gotKeys, err := db.Keys("devices")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(gotKeys)
+
+			wantKeys := []string{keys[0], keys[2]}
+			sort.Strings(wantKeys)
+
+			if fmt.Sprint(wantKeys) != fmt.Sprint(gotKeys) {
+				t.Errorf("want %v; got %v", wantKeys, gotKeys)
+			}
+
+			d := Device{}
+			if err := db.FindKeyed("devices", keys[0], &d); err != nil {
+				t.Fatal(err)
+			}
+
+			want := "a laptop with a much longer name"
+			got := d.Name
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+	}
+
+	for i, fn := range tests {
+		t.Run(strconv.Itoa(i), fn)
+	}
+}
+
+// newKeyedTestDB returns a Database with a "devices" table keyed by
+// ULIDs, a "phones" table keyed by the caller and a "contacts" table
+// with int ids.
+func newKeyedTestDB(t *testing.T, ds Datastore) *Database {
+	db, err := New(ds, WithKeys("devices", ULID), WithKeys("phones", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tableName := range []string{"contacts", "devices", "phones"} {
+		if !db.TableExists(tableName) {
+			if err := db.CreateTable(tableName); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	return db
+}
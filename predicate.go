@@ -0,0 +1,125 @@
+package hare
+
+import "encoding/json"
+
+type operator int
+
+const (
+	opFunc operator = iota
+	opEq
+	opNe
+	opLt
+	opLe
+	opGt
+	opGe
+)
+
+// Predicate is a condition on a record's JSON fields that a record
+// must satisfy to be returned by a Query.  Field names may be dotted
+// paths into nested objects, i.e. "host.name".
+type Predicate struct {
+	field string
+	op    operator
+	value interface{}
+	fn    func(map[string]interface{}) bool
+}
+
+// Eq takes a field name and a value and matches records where the
+// field is equal to the value.
+func Eq(field string, value interface{}) Predicate {
+	return Predicate{field: field, op: opEq, value: value}
+}
+
+// Ne takes a field name and a value and matches records where the
+// field is not equal to the value.
+func Ne(field string, value interface{}) Predicate {
+	return Predicate{field: field, op: opNe, value: value}
+}
+
+// Lt takes a field name and a value and matches records where the
+// field is less than the value.
+func Lt(field string, value interface{}) Predicate {
+	return Predicate{field: field, op: opLt, value: value}
+}
+
+// Le takes a field name and a value and matches records where the
+// field is less than or equal to the value.
+func Le(field string, value interface{}) Predicate {
+	return Predicate{field: field, op: opLe, value: value}
+}
+
+// Gt takes a field name and a value and matches records where the
+// field is greater than the value.
+func Gt(field string, value interface{}) Predicate {
+	return Predicate{field: field, op: opGt, value: value}
+}
+
+// Ge takes a field name and a value and matches records where the
+// field is greater than or equal to the value.
+func Ge(field string, value interface{}) Predicate {
+	return Predicate{field: field, op: opGe, value: value}
+}
+
+// Match takes a function that is passed the record's decoded JSON
+// fields and matches records for which it returns true.
+func Match(fn func(fields map[string]interface{}) bool) Predicate {
+	return Predicate{op: opFunc, fn: fn}
+}
+
+// normalize returns a copy of the predicate with its value run through
+// encoding/json, so that i.e. an int compares equal to the float64
+// that a decoded record holds.
+func (p Predicate) normalize() (Predicate, error) {
+	if p.op == opFunc {
+		return p, nil
+	}
+
+	b, err := json.Marshal(p.value)
+	if err != nil {
+		return p, err
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return p, err
+	}
+	p.value = v
+
+	return p, nil
+}
+
+func (p Predicate) matches(fields map[string]interface{}) bool {
+	if p.op == opFunc {
+		return p.fn(fields)
+	}
+
+	v := fieldValue(fields, p.field)
+
+	switch p.op {
+	case opEq:
+		return equalValues(v, p.value)
+	case opNe:
+		return !equalValues(v, p.value)
+	}
+
+	// Ordering comparisons only make sense between values of the same
+	// kind, so a missing field never satisfies them.
+	if kindRank(v) != kindRank(p.value) {
+		return false
+	}
+
+	c := compareValues(v, p.value)
+
+	switch p.op {
+	case opLt:
+		return c < 0
+	case opLe:
+		return c <= 0
+	case opGt:
+		return c > 0
+	case opGe:
+		return c >= 0
+	}
+
+	return false
+}
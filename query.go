@@ -0,0 +1,373 @@
+package hare
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// Query is a query against a single table.  Create one with
+// Database.Query, narrow it down with Where, OrderBy, Limit and
+// Offset, then run it with IDs, Count or First.  Unless OrderBy says
+// otherwise, results are ordered by record id.
+type Query struct {
+	db        *Database
+	tableName string
+	preds     []Predicate
+	orders    []order
+	limit     int
+	offset    int
+}
+
+type order struct {
+	field string
+	desc  bool
+}
+
+// match is a record that satisfied every predicate of a query.
+type match struct {
+	id     int
+	rawRec []byte
+	fields map[string]interface{}
+}
+
+// Query takes a table name and returns a new Query against that table.
+func (db *Database) Query(tableName string) *Query {
+	return &Query{db: db, tableName: tableName}
+}
+
+// Where takes one or more predicates that a record must satisfy to
+// be included in the results.  Calling it again adds to the existing
+// predicates.
+func (q *Query) Where(preds ...Predicate) *Query {
+	q.preds = append(q.preds, preds...)
+
+	return q
+}
+
+// OrderBy takes one or more JSON field names to sort the results by.
+// Prefix a field name with "-" to sort it in descending order.  Ties
+// are broken by the next field and finally by record id.
+func (q *Query) OrderBy(fields ...string) *Query {
+	for _, field := range fields {
+		if strings.HasPrefix(field, "-") {
+			q.orders = append(q.orders, order{field: field[1:], desc: true})
+		} else {
+			q.orders = append(q.orders, order{field: field})
+		}
+	}
+
+	return q
+}
+
+// Limit takes the maximum number of records to return.  Zero means
+// no limit.
+func (q *Query) Limit(n int) *Query {
+	q.limit = n
+
+	return q
+}
+
+// Offset takes the number of matching records to skip before
+// returning results.
+func (q *Query) Offset(n int) *Query {
+	q.offset = n
+
+	return q
+}
+
+// Count returns the number of records that match the query, taking
+// limit and offset into account.
+func (q *Query) Count() (_ int, err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Query", Table: q.tableName})
+
+	matches, err := q.run()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(matches), nil
+}
+
+// First takes a pointer to a struct that implements the Record
+// interface and populates it with the first record matching the
+// query.  It returns dberr.ErrNoRecord if nothing matches.
+func (q *Query) First(rec Record) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Query", Table: q.tableName})
+
+	first := *q
+	first.limit = 1
+
+	matches, err := first.run()
+	if err != nil {
+		return err
+	}
+
+	if len(matches) == 0 {
+		return dberr.ErrNoRecord
+	}
+
+	return q.db.unmarshalRec(q.tableName, matches[0].rawRec, rec)
+}
+
+// IDs returns the ids of the records that match the query, in order.
+func (q *Query) IDs() (_ []int, err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Query", Table: q.tableName})
+
+	matches, err := q.run()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, m := range matches {
+		ids = append(ids, m.id)
+	}
+
+	return ids, nil
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+func (q *Query) run() ([]match, error) {
+	if err := q.db.enter(); err != nil {
+		return nil, err
+	}
+	defer q.db.exit()
+
+	if !q.db.hasTable(q.tableName) {
+		return nil, dberr.ErrNoTable
+	}
+
+	if q.db.isKeyed(q.tableName) {
+		return nil, dberr.ErrNotSupported
+	}
+
+	preds := make([]Predicate, len(q.preds))
+	for i, p := range q.preds {
+		np, err := p.normalize()
+		if err != nil {
+			return nil, err
+		}
+		preds[i] = np
+	}
+
+	matches, err := q.scan(preds)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(q.orders) > 0 {
+		sort.SliceStable(matches, func(i, j int) bool {
+			for _, o := range q.orders {
+				c := compareValues(fieldValue(matches[i].fields, o.field), fieldValue(matches[j].fields, o.field))
+				if c == 0 {
+					continue
+				}
+				if o.desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+
+	if q.offset > 0 {
+		if q.offset >= len(matches) {
+			return nil, nil
+		}
+		matches = matches[q.offset:]
+	}
+
+	if q.limit > 0 && q.limit < len(matches) {
+		matches = matches[:q.limit]
+	}
+
+	return matches, nil
+}
+
+// scan reads the records in the table, under a read lock, and returns
+// the ones matching preds ordered by id.  If one of the predicates is
+// on an indexed field, only the records the index points to are read.
+func (q *Query) scan(preds []Predicate) ([]match, error) {
+	db := q.db
+
+	lock, err := db.rlockTable(q.tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.RUnlock()
+
+	var matches []match
+
+	keep := func(id int, rawRec []byte) error {
+		fields, err := db.decodeFields(q.tableName, rawRec)
+		if err != nil {
+			return err
+		}
+
+		if matchesAll(preds, fields) {
+			matches = append(matches, match{id: id, rawRec: rawRec, fields: fields})
+		}
+
+		return nil
+	}
+
+	idx, p, ok := db.indexFor(q.tableName, preds)
+	if !ok {
+		if err := db.scanTable(q.tableName, keep); err != nil {
+			return nil, err
+		}
+
+		sort.Slice(matches, func(i, j int) bool { return matches[i].id < matches[j].id })
+
+		return matches, nil
+	}
+
+	for _, id := range idx.lookup(p) {
+		rawRec, err := db.store.ReadRec(q.tableName, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := keep(id, rawRec); err != nil {
+			return nil, err
+		}
+	}
+
+	return matches, nil
+}
+
+func matchesAll(preds []Predicate, fields map[string]interface{}) bool {
+	for _, p := range preds {
+		if !p.matches(fields) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// fieldValue takes decoded record fields and a field name, which may
+// be a dotted path into nested objects, and returns the field's value
+// or nil if there is no such field.
+func fieldValue(fields map[string]interface{}, name string) interface{} {
+	var v interface{} = fields
+
+	for _, part := range strings.Split(name, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[part]
+	}
+
+	return v
+}
+
+// compareValues orders two decoded JSON values.  Values of different
+// kinds are ordered null < bool < number < string < everything else.
+func compareValues(a, b interface{}) int {
+	ra, rb := kindRank(a), kindRank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+
+	switch av := a.(type) {
+	case bool:
+		bv := b.(bool)
+		switch {
+		case av == bv:
+			return 0
+		case !av:
+			return -1
+		default:
+			return 1
+		}
+	case float64:
+		bv := b.(float64)
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		default:
+			return 0
+		}
+	case string:
+		return strings.Compare(av, b.(string))
+	}
+
+	// Arrays and objects have no natural order.
+	return 0
+}
+
+func equalValues(a, b interface{}) bool {
+	if kindRank(a) == 4 || kindRank(b) == 4 {
+		return reflect.DeepEqual(a, b)
+	}
+
+	return compareValues(a, b) == 0
+}
+
+// normalizeValue converts the numbers in a decoded value to float64,
+// so that records decoded by any codec compare the same way.
+func normalizeValue(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case int:
+		return float64(tv)
+	case int8:
+		return float64(tv)
+	case int16:
+		return float64(tv)
+	case int32:
+		return float64(tv)
+	case int64:
+		return float64(tv)
+	case uint:
+		return float64(tv)
+	case uint8:
+		return float64(tv)
+	case uint16:
+		return float64(tv)
+	case uint32:
+		return float64(tv)
+	case uint64:
+		return float64(tv)
+	case float32:
+		return float64(tv)
+	case map[string]interface{}:
+		for k, e := range tv {
+			tv[k] = normalizeValue(e)
+		}
+	case []interface{}:
+		for i, e := range tv {
+			tv[i] = normalizeValue(e)
+		}
+	}
+
+	return v
+}
+
+func kindRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64:
+		return 2
+	case string:
+		return 3
+	default:
+		return 4
+	}
+}
@@ -0,0 +1,166 @@
+package hare
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestQueryTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//IDs (no predicates)...
+
+			return func(t *testing.T) {
+				want := []int{1, 2, 3, 4}
+				got, err := db.Query("contacts").IDs()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Where...
+
+			return func(t *testing.T) {
+				tests := []struct {
+					preds []Predicate
+					want  []int
+				}{
+					{[]Predicate{Eq("first_name", "Abe")}, []int{2}},
+					{[]Predicate{Ne("first_name", "Abe")}, []int{1, 3, 4}},
+					{[]Predicate{Lt("age", 25)}, []int{3}},
+					{[]Predicate{Le("age", 25)}, []int{3, 4}},
+					{[]Predicate{Gt("age", 37)}, []int{2}},
+					{[]Predicate{Ge("age", 37)}, []int{1, 2}},
+					{[]Predicate{Ge("age", 20), Lt("age", 40)}, []int{1, 4}},
+					{[]Predicate{Gt("first_name", 1)}, nil},
+					{[]Predicate{Eq("nonexistent", nil)}, []int{1, 2, 3, 4}},
+					{[]Predicate{Match(func(f map[string]interface{}) bool {
+						return len(f["last_name"].(string)) > 6
+					})}, []int{2, 3}},
+				}
+
+				for _, tt := range tests {
+					got, err := db.Query("contacts").Where(tt.preds...).IDs()
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if !reflect.DeepEqual(tt.want, got) {
+						t.Errorf("want %v; got %v", tt.want, got)
+					}
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//OrderBy, Limit and Offset...
+
+			return func(t *testing.T) {
+				tests := []struct {
+					q    *Query
+					want []int
+				}{
+					{db.Query("contacts").OrderBy("age"), []int{3, 4, 1, 2}},
+					{db.Query("contacts").OrderBy("-age"), []int{2, 1, 4, 3}},
+					{db.Query("contacts").OrderBy("last_name"), []int{1, 4, 2, 3}},
+					{db.Query("contacts").OrderBy("age").Limit(2), []int{3, 4}},
+					{db.Query("contacts").OrderBy("age").Offset(1).Limit(2), []int{4, 1}},
+					{db.Query("contacts").Offset(4), nil},
+				}
+
+				for _, tt := range tests {
+					got, err := tt.q.IDs()
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if !reflect.DeepEqual(tt.want, got) {
+						t.Errorf("want %v; got %v", tt.want, got)
+					}
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Count...
+
+			return func(t *testing.T) {
+				want := 2
+				got, err := db.Query("contacts").Where(Gt("age", 30)).Count()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//First...
+
+			return func(t *testing.T) {
+				c := Contact{}
+
+				err := db.Query("contacts").OrderBy("-age").First(&c)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := "Abe"
+				got := c.FirstName
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//First (ErrNoRecord error)...
+
+			return func(t *testing.T) {
+				gotErr := db.Query("contacts").Where(Eq("first_name", "Nobody")).First(&Contact{})
+
+				checkErr(t, dberr.ErrNoRecord, gotErr)
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//IDs (ErrNoTable error)...
+
+			return func(t *testing.T) {
+				_, gotErr := db.Query("nonexistent").IDs()
+
+				checkErr(t, dberr.ErrNoTable, gotErr)
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Table Fetch...
+
+			return func(t *testing.T) {
+				contacts := NewTable[Contact](db, "contacts")
+
+				recs, err := contacts.Fetch(contacts.Query().Where(Lt("age", 40)).OrderBy("first_name"))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := []string{"Bill", "Helen", "John"}
+				var got []string
+				for _, c := range recs {
+					got = append(got, c.FirstName)
+				}
+
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
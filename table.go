@@ -0,0 +1,119 @@
+package hare
+
+import "sort"
+
+// Table is a typed handle to a single table in a Database.  T is the
+// model struct and PT is the pointer to it that implements the Record
+// interface, so models don't need their own query boilerplate.
+type Table[T any, PT interface {
+	*T
+	Record
+}] struct {
+	db   *Database
+	name string
+}
+
+// NewTable takes a Database and a table name and returns a typed
+// handle to that table.  Only the model type needs to be given, i.e.
+// hare.NewTable[models.Episode](db, "episodes").
+func NewTable[T any, PT interface {
+	*T
+	Record
+}](db *Database, tableName string) *Table[T, PT] {
+	return &Table[T, PT]{db: db, name: tableName}
+}
+
+// Name returns the name of the table.
+func (t *Table[T, PT]) Name() string {
+	return t.name
+}
+
+// All returns every record in the table, ordered by id.
+func (t *Table[T, PT]) All() ([]T, error) {
+	return t.Where(func(T) bool { return true })
+}
+
+// Delete takes a record id and removes that record from the table.
+// Unlike Database.Delete, it knows the record's type, so if the model
+// implements BeforeDeleter or AfterDeleter, the record is found and its
+// hooks are run.
+func (t *Table[T, PT]) Delete(id int) error {
+	return t.db.deleteWithHooks(t.name, id, PT(new(T)))
+}
+
+// Fetch takes a query against this table and returns the matching
+// records, in the order the query specifies.
+func (t *Table[T, PT]) Fetch(q *Query) ([]T, error) {
+	matches, err := q.run()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]T, 0, len(matches))
+	for _, m := range matches {
+		rec := new(T)
+
+		if err := t.db.unmarshalRec(q.tableName, m.rawRec, PT(rec)); err != nil {
+			return nil, err
+		}
+
+		results = append(results, *rec)
+	}
+
+	return results, nil
+}
+
+// Find takes a record id and returns the populated record.
+func (t *Table[T, PT]) Find(id int) (*T, error) {
+	rec := new(T)
+
+	if err := t.db.Find(t.name, id, PT(rec)); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// Insert takes a record and adds it to the table.  It returns the
+// new record's id.
+func (t *Table[T, PT]) Insert(rec *T) (int, error) {
+	return t.db.Insert(t.name, PT(rec))
+}
+
+// Query returns a new Query against this table, to be run with Fetch.
+func (t *Table[T, PT]) Query() *Query {
+	return t.db.Query(t.name)
+}
+
+// Update takes a record and updates the record in the table that has
+// that record's id.
+func (t *Table[T, PT]) Update(rec *T) error {
+	return t.db.Update(t.name, PT(rec))
+}
+
+// Where takes a query function and returns, ordered by id, every record
+// in the table for which it returns true.
+func (t *Table[T, PT]) Where(queryFn func(T) bool) ([]T, error) {
+	var results []T
+
+	ids, err := t.db.IDs(t.name)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		rec := new(T)
+
+		if err := t.db.Find(t.name, id, PT(rec)); err != nil {
+			return nil, err
+		}
+
+		if queryFn(*rec) {
+			results = append(results, *rec)
+		}
+	}
+
+	return results, nil
+}
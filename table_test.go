@@ -0,0 +1,139 @@
+package hare
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestTableHandleTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//All...
+
+			return func(t *testing.T) {
+				contacts := NewTable[Contact](db, "contacts")
+
+				recs, err := contacts.All()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := []int{1, 2, 3, 4}
+				if len(want) != len(recs) {
+					t.Fatalf("want %v; got %v", want, recs)
+				}
+
+				for i := range want {
+					if want[i] != recs[i].ID {
+						t.Errorf("want %v; got %v", want[i], recs[i].ID)
+					}
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Find...
+
+			return func(t *testing.T) {
+				contacts := NewTable[Contact](db, "contacts")
+
+				c, err := contacts.Find(2)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := "Abe Lincoln is 52"
+				got := fmt.Sprintf("%s %s is %d", c.FirstName, c.LastName, c.Age)
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Find (ErrNoRecord error)...
+
+			return func(t *testing.T) {
+				_, gotErr := NewTable[Contact](db, "contacts").Find(99)
+
+				checkErr(t, dberr.ErrNoRecord, gotErr)
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Insert, Update and Delete...
+
+			return func(t *testing.T) {
+				contacts := NewTable[Contact](db, "contacts")
+
+				c := Contact{FirstName: "Robin", LastName: "Williams", Age: 88}
+
+				id, err := contacts.Insert(&c)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if id != c.ID {
+					t.Errorf("want %v; got %v", id, c.ID)
+				}
+
+				c.Age = 89
+				if err := contacts.Update(&c); err != nil {
+					t.Fatal(err)
+				}
+
+				got, err := contacts.Find(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got.Age != 89 {
+					t.Errorf("want %v; got %v", 89, got.Age)
+				}
+
+				if err := contacts.Delete(id); err != nil {
+					t.Fatal(err)
+				}
+
+				_, gotErr := contacts.Find(id)
+				checkErr(t, dberr.ErrNoRecord, gotErr)
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Where...
+
+			return func(t *testing.T) {
+				recs, err := NewTable[Contact](db, "contacts").Where(func(c Contact) bool {
+					return c.Age > 30
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := []string{"John", "Abe"}
+				if len(want) != len(recs) {
+					t.Fatalf("want %v; got %v", want, recs)
+				}
+
+				for i := range want {
+					if want[i] != recs[i].FirstName {
+						t.Errorf("want %v; got %v", want[i], recs[i].FirstName)
+					}
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Where (ErrNoTable error)...
+
+			return func(t *testing.T) {
+				_, gotErr := NewTable[Contact](db, "nonexistent").Where(func(c Contact) bool {
+					return true
+				})
+
+				checkErr(t, dberr.ErrNoTable, gotErr)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
@@ -48,10 +48,13 @@ func runTestFns(t *testing.T, testFns []func(*Database) func(*testing.T)) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		defer diskDB.Close()
 
 		t.Run(fmt.Sprintf("disk/%s", tstNum), fn(diskDB))
 
+		// Release the datastore's lock on testdata before the next
+		// test opens it, whether or not the test closed the database.
+		diskDS.Close()
+
 		ramDS, err := ram.New(seedData())
 		if err != nil {
 			t.Fatal(err)
@@ -89,7 +92,7 @@ func testTeardown(t *testing.T) {
 }
 
 func testRemoveFiles(t *testing.T) {
-	filesToRemove := []string{"contacts.json", "newtable.json"}
+	filesToRemove := []string{"contacts.json", "contacts.seq", "contacts.wal", "newtable.json", "newtable.seq", "newtable.wal", "hare.lock", "hare.txlog"}
 
 	for _, f := range filesToRemove {
 		err := os.Remove("./testdata/" + f)
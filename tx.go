@@ -0,0 +1,435 @@
+package hare
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+type txOpKind int
+
+const (
+	txInsert txOpKind = iota
+	txUpdate
+	txDelete
+)
+
+// txOp is a single change staged in a transaction.
+type txOp struct {
+	kind      txOpKind
+	tableName string
+	id        int
+	rawRec    []byte
+	rec       Record
+}
+
+// undoOp is a change applied by Commit, along with what is needed to
+// reverse it.
+type undoOp struct {
+	txOp
+	oldRec []byte
+}
+
+// Tx is a transaction.  It stages inserts, updates and deletes on any
+// number of tables, and then either applies all of them with Commit or
+// discards all of them with Rollback.
+type Tx struct {
+	db   *Database
+	ops  []txOp
+	done bool
+}
+
+// Begin starts a new transaction.  Transactions need a datastore that
+// implements Batcher; with any other, staging a change and Commit
+// return dberr.ErrNotSupported.
+func (db *Database) Begin() *Tx {
+	return &Tx{db: db}
+}
+
+// Commit applies every change staged in the transaction, as one batch
+// of the datastore's Batcher, so a crash part way through Commit leaves
+// either all of them applied or none.  The tables involved are write
+// locked for the duration, and if any change fails, the ones already
+// applied are reversed before the error is returned.  If reversing one
+// fails too, the error also matches dberr.ErrRollback and holds why, as
+// the database is left with part of the transaction.  Once every change
+// has been applied and the locks released, the AfterInsert, AfterUpdate
+// and AfterDelete hooks of the staged records are run, and the first
+// error one of them returns is returned.
+func (tx *Tx) Commit() (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Commit"})
+
+	if tx.done {
+		return dberr.ErrTxDone
+	}
+
+	if err := tx.db.enter(); err != nil {
+		return err
+	}
+	defer tx.db.exit()
+
+	batcher, ok := tx.db.store.(Batcher)
+	if !ok {
+		return dberr.ErrNotSupported
+	}
+
+	tx.done = true
+
+	if err := tx.applyAll(batcher); err != nil {
+		return err
+	}
+
+	var hookErr error
+
+	for _, op := range tx.ops {
+		var err error
+
+		switch op.kind {
+		case txInsert:
+			err = tx.db.afterInsert(op.rec)
+		case txUpdate:
+			err = tx.db.afterUpdate(op.rec)
+		case txDelete:
+			err = tx.db.afterDelete(op.rec)
+		}
+
+		if err != nil && hookErr == nil {
+			hookErr = err
+		}
+	}
+
+	return hookErr
+}
+
+// Delete takes a table name and a record id and stages the removal of
+// that record.  As with Database.Delete, delete hooks are not run; use
+// DeleteRecord for models that have them.
+func (tx *Tx) Delete(tableName string, id int) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Delete", Table: tableName, ID: id})
+
+	if err := tx.db.enter(); err != nil {
+		return err
+	}
+	defer tx.db.exit()
+
+	if err := tx.check(tableName); err != nil {
+		return err
+	}
+
+	tx.ops = append(tx.ops, txOp{kind: txDelete, tableName: tableName, id: id})
+
+	return nil
+}
+
+// DeleteRecord takes a table name and a struct that implements the
+// Record interface and stages the removal of the record that has that
+// record's id.  The record's BeforeDelete hook, if it has one, is run
+// now, and an error from it means nothing is staged.
+func (tx *Tx) DeleteRecord(tableName string, rec Record) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "DeleteRecord", Table: tableName, ID: rec.GetID()})
+
+	if err := tx.db.enter(); err != nil {
+		return err
+	}
+	defer tx.db.exit()
+
+	if err := tx.check(tableName); err != nil {
+		return err
+	}
+
+	if err := tx.db.beforeDelete(rec); err != nil {
+		return err
+	}
+
+	tx.ops = append(tx.ops, txOp{kind: txDelete, tableName: tableName, id: rec.GetID(), rec: rec})
+
+	return nil
+}
+
+// Find takes a table name, a record id, and a pointer to a struct that
+// implements the Record interface and populates the struct.  Changes
+// staged in the transaction are visible to Find.
+func (tx *Tx) Find(tableName string, id int, rec Record) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Find", Table: tableName, ID: id})
+
+	if err := tx.db.enter(); err != nil {
+		return err
+	}
+	defer tx.db.exit()
+
+	if err := tx.check(tableName); err != nil {
+		return err
+	}
+
+	for i := len(tx.ops) - 1; i >= 0; i-- {
+		op := tx.ops[i]
+
+		if op.tableName != tableName || op.id != id {
+			continue
+		}
+
+		if op.kind == txDelete {
+			return dberr.ErrNoRecord
+		}
+
+		return tx.db.unmarshalRec(tableName, op.rawRec, rec)
+	}
+
+	return tx.db.Find(tableName, id, rec)
+}
+
+// Insert takes a table name and a struct that implements the Record
+// interface and stages adding it to the table.  The new record's id is
+// assigned straight away and returned.  The record's BeforeInsert hook,
+// if it has one, is run now, and an error from it means nothing is
+// staged.
+func (tx *Tx) Insert(tableName string, rec Record) (_ int, err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Insert", Table: tableName})
+
+	if err := tx.db.enter(); err != nil {
+		return 0, err
+	}
+	defer tx.db.exit()
+
+	if err := tx.check(tableName); err != nil {
+		return 0, err
+	}
+
+	if err := tx.db.beforeInsert(rec); err != nil {
+		return 0, err
+	}
+
+	lock, err := tx.db.lockTable(tableName)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := tx.db.incrementLastID(tableName)
+	lock.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+
+	rec.SetID(id)
+
+	rawRec, err := tx.db.marshalRec(tableName, rec)
+	if err != nil {
+		return 0, err
+	}
+
+	tx.ops = append(tx.ops, txOp{kind: txInsert, tableName: tableName, id: id, rawRec: rawRec, rec: rec})
+
+	return id, nil
+}
+
+// Rollback discards every change staged in the transaction.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return dberr.ErrTxDone
+	}
+	tx.done = true
+
+	tx.ops = nil
+
+	return nil
+}
+
+// Update takes a table name and a struct that implements the Record
+// interface and stages updating the record in the table that has that
+// record's id.  The record's BeforeUpdate hook, if it has one, is run
+// now, and an error from it means nothing is staged.
+func (tx *Tx) Update(tableName string, rec Record) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Update", Table: tableName, ID: rec.GetID()})
+
+	if err := tx.db.enter(); err != nil {
+		return err
+	}
+	defer tx.db.exit()
+
+	if err := tx.check(tableName); err != nil {
+		return err
+	}
+
+	if err := tx.db.beforeUpdate(rec); err != nil {
+		return err
+	}
+
+	rawRec, err := tx.db.marshalRec(tableName, rec)
+	if err != nil {
+		return err
+	}
+
+	tx.ops = append(tx.ops, txOp{kind: txUpdate, tableName: tableName, id: rec.GetID(), rawRec: rawRec, rec: rec})
+
+	return nil
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+// applyAll write locks the tables involved in the transaction and
+// applies every staged change in one batch, reversing them all if one
+// fails.  Only once they have all been applied are Watchers told about
+// them.
+func (tx *Tx) applyAll(batcher Batcher) error {
+	db := tx.db
+
+	tableNames := tx.tableNames()
+
+	var locks []*sync.RWMutex
+
+	defer func() {
+		for _, lock := range locks {
+			lock.Unlock()
+		}
+	}()
+
+	for _, tableName := range tableNames {
+		lock, err := db.lockTable(tableName)
+		if err != nil {
+			wrapErr(&err, dberr.Error{Op: "Commit", Table: tableName})
+			return err
+		}
+		locks = append(locks, lock)
+	}
+
+	err := batcher.Batch(tableNames, func() error {
+		var applied []undoOp
+
+		for _, op := range tx.ops {
+			undo, err := tx.apply(op)
+			if err != nil {
+				wrapErr(&err, dberr.Error{Op: "Commit", Table: op.tableName, ID: op.id})
+
+				if undoErr := tx.undo(applied); undoErr != nil {
+					return fmt.Errorf("%w; %w: %w", err, dberr.ErrRollback, undoErr)
+				}
+
+				return err
+			}
+
+			applied = append(applied, undo)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, op := range tx.ops {
+		switch op.kind {
+		case txInsert:
+			db.emit(EventInsert, op.tableName, op.id, op.rawRec)
+		case txUpdate:
+			db.emit(EventUpdate, op.tableName, op.id, op.rawRec)
+		case txDelete:
+			db.emit(EventDelete, op.tableName, op.id, nil)
+		}
+	}
+
+	return nil
+}
+
+// apply makes a staged change to the database and returns what is
+// needed to undo it.
+func (tx *Tx) apply(op txOp) (undoOp, error) {
+	db := tx.db
+	undo := undoOp{txOp: op}
+
+	if op.kind != txInsert {
+		oldRec, err := db.store.ReadRec(op.tableName, op.id)
+		if err != nil {
+			return undo, err
+		}
+		undo.oldRec = bytes.TrimSuffix(oldRec, []byte("\n"))
+	}
+
+	var err error
+
+	switch op.kind {
+	case txInsert:
+		err = db.insertRec(op.tableName, op.id, op.rawRec)
+	case txUpdate:
+		err = db.updateRec(op.tableName, op.id, op.rawRec)
+	case txDelete:
+		err = db.deleteRec(op.tableName, op.id)
+	}
+
+	return undo, err
+}
+
+func (tx *Tx) check(tableName string) error {
+	if tx.done {
+		return dberr.ErrTxDone
+	}
+
+	if !tx.db.hasTable(tableName) {
+		return dberr.ErrNoTable
+	}
+
+	if tx.db.isKeyed(tableName) {
+		return dberr.ErrNotSupported
+	}
+
+	if _, ok := tx.db.store.(Batcher); !ok {
+		return dberr.ErrNotSupported
+	}
+
+	return nil
+}
+
+// tableNames returns the names of the tables touched by the
+// transaction, sorted so that locks are always taken in the same order.
+func (tx *Tx) tableNames() []string {
+	seen := make(map[string]bool)
+
+	var tableNames []string
+	for _, op := range tx.ops {
+		if !seen[op.tableName] {
+			seen[op.tableName] = true
+			tableNames = append(tableNames, op.tableName)
+		}
+	}
+
+	sort.Strings(tableNames)
+
+	return tableNames
+}
+
+// undo reverses applied changes, newest first.  A change that can't be
+// reversed doesn't stop the others from being reversed, and the errors
+// are returned joined together.
+func (tx *Tx) undo(applied []undoOp) error {
+	db := tx.db
+
+	var errs []error
+
+	for i := len(applied) - 1; i >= 0; i-- {
+		op := applied[i]
+
+		var err error
+
+		switch op.kind {
+		case txInsert:
+			err = db.deleteRec(op.tableName, op.id)
+		case txUpdate:
+			err = db.updateRec(op.tableName, op.id, op.oldRec)
+		case txDelete:
+			err = db.insertRec(op.tableName, op.id, op.oldRec)
+		}
+
+		if err != nil {
+			wrapErr(&err, dberr.Error{Op: "Rollback", Table: op.tableName, ID: op.id})
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,268 @@
+package hare
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestTxTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//Commit...
+
+			return func(t *testing.T) {
+				if err := db.CreateTable("newtable"); err != nil {
+					t.Fatal(err)
+				}
+
+				tx := db.Begin()
+
+				id, err := tx.Insert("contacts", &Contact{FirstName: "Robin", LastName: "Williams", Age: 88})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Update("contacts", &Contact{ID: 4, FirstName: "Hazel", LastName: "Koller", Age: 26}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Delete("contacts", 3); err != nil {
+					t.Fatal(err)
+				}
+
+				newID, err := tx.Insert("newtable", &Contact{FirstName: "Rex", LastName: "Stout", Age: 77})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// Nothing is visible outside the transaction before Commit.
+				checkErr(t, dberr.ErrNoRecord, db.Find("contacts", id, &Contact{}))
+				checkErr(t, dberr.ErrNoRecord, db.Find("newtable", newID, &Contact{}))
+
+				if err := tx.Commit(); err != nil {
+					t.Fatal(err)
+				}
+
+				c := Contact{}
+
+				if err := db.Find("contacts", id, &c); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.Find("contacts", 4, &c); err != nil {
+					t.Fatal(err)
+				}
+
+				want := "Hazel Koller is 26"
+				got := fmt.Sprintf("%s %s is %d", c.FirstName, c.LastName, c.Age)
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				checkErr(t, dberr.ErrNoRecord, db.Find("contacts", 3, &Contact{}))
+
+				if err := db.Find("newtable", newID, &c); err != nil {
+					t.Fatal(err)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Commit (failure rolls back applied changes)...
+
+			return func(t *testing.T) {
+				if err := db.CreateIndex("contacts", "last_name"); err != nil {
+					t.Fatal(err)
+				}
+
+				tx := db.Begin()
+
+				id, err := tx.Insert("contacts", &Contact{FirstName: "Robin", LastName: "Williams", Age: 88})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Update("contacts", &Contact{ID: 4, FirstName: "Hazel", LastName: "Koller", Age: 26}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Delete("contacts", 2); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Update("contacts", &Contact{ID: 99, FirstName: "No", LastName: "Body"}); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrNoRecord, tx.Commit())
+
+				checkErr(t, dberr.ErrNoRecord, db.Find("contacts", id, &Contact{}))
+
+				c := Contact{}
+
+				if err := db.Find("contacts", 4, &c); err != nil {
+					t.Fatal(err)
+				}
+
+				want := "Helen Keller is 25"
+				got := fmt.Sprintf("%s %s is %d", c.FirstName, c.LastName, c.Age)
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				if err := db.Find("contacts", 2, &c); err != nil {
+					t.Fatal(err)
+				}
+
+				ids, err := db.Query("contacts").Where(Eq("last_name", "Keller")).IDs()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(ids) != 1 || ids[0] != 4 {
+					t.Errorf("want %v; got %v", []int{4}, ids)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Commit (failure that can't be rolled back)...
+
+			return func(t *testing.T) {
+				tx := db.Begin()
+
+				if err := tx.Delete("contacts", 2); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Update("contacts", &Contact{ID: 99, FirstName: "No", LastName: "Body"}); err != nil {
+					t.Fatal(err)
+				}
+
+				db.store = failingInsertStore{db.store}
+
+				gotErr := tx.Commit()
+
+				checkErr(t, dberr.ErrNoRecord, gotErr)
+				checkErr(t, dberr.ErrRollback, gotErr)
+				checkErr(t, errInsertFailed, gotErr)
+
+				var dbErr *dberr.Error
+				if !errors.As(gotErr, &dbErr) || dbErr.Op != "Commit" || dbErr.ID != 99 {
+					t.Errorf("want %v; got %v", "Commit contacts record 99", dbErr)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Rollback...
+
+			return func(t *testing.T) {
+				tx := db.Begin()
+
+				id, err := tx.Insert("contacts", &Contact{FirstName: "Robin", LastName: "Williams", Age: 88})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Rollback(); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrNoRecord, db.Find("contacts", id, &Contact{}))
+				checkErr(t, dberr.ErrTxDone, tx.Commit())
+				checkErr(t, dberr.ErrTxDone, tx.Rollback())
+				checkErr(t, dberr.ErrTxDone, tx.Delete("contacts", 1))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Find (sees staged changes)...
+
+			return func(t *testing.T) {
+				tx := db.Begin()
+				defer tx.Rollback()
+
+				if err := tx.Update("contacts", &Contact{ID: 4, FirstName: "Hazel", LastName: "Koller", Age: 26}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := tx.Delete("contacts", 3); err != nil {
+					t.Fatal(err)
+				}
+
+				c := Contact{}
+
+				if err := tx.Find("contacts", 4, &c); err != nil {
+					t.Fatal(err)
+				}
+
+				want := "Hazel"
+				got := c.FirstName
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				checkErr(t, dberr.ErrNoRecord, tx.Find("contacts", 3, &Contact{}))
+
+				if err := tx.Find("contacts", 2, &c); err != nil {
+					t.Fatal(err)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Commit (datastore without Batcher)...
+
+			return func(t *testing.T) {
+				tx := db.Begin()
+
+				if err := tx.Delete("contacts", 2); err != nil {
+					t.Fatal(err)
+				}
+
+				db.store = unbatchedStore{db.store}
+
+				checkErr(t, dberr.ErrNotSupported, tx.Commit())
+
+				if err := db.Find("contacts", 2, &Contact{}); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrNotSupported, db.Begin().Delete("contacts", 2))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Insert (NoTable error)...
+
+			return func(t *testing.T) {
+				_, gotErr := db.Begin().Insert("nonexistent", &Contact{})
+
+				checkErr(t, dberr.ErrNoTable, gotErr)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
+var errInsertFailed = errors.New("insert failed")
+
+// failingInsertStore is a Datastore whose inserts always fail.
+type failingInsertStore struct {
+	Datastore
+}
+
+func (s failingInsertStore) InsertRec(tableName string, id int, rec []byte) error {
+	return errInsertFailed
+}
+
+func (s failingInsertStore) Batch(tableNames []string, fn func() error) error {
+	return s.Datastore.(Batcher).Batch(tableNames, fn)
+}
+
+// unbatchedStore is a Datastore that doesn't implement Batcher.
+type unbatchedStore struct {
+	Datastore
+}
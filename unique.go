@@ -0,0 +1,198 @@
+package hare
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// unique is a unique constraint on one JSON field, or a combination of
+// JSON fields, of a table.  It maps each combination of values in use
+// to the id of the record holding it.  Records missing any of the
+// fields, or holding null in one, are not constrained.
+type unique struct {
+	fields []string
+	ids    map[string]int
+}
+
+func newUnique(fields []string) *unique {
+	return &unique{fields: fields, ids: make(map[string]int)}
+}
+
+// CreateUnique takes a table name and one or more JSON field names and
+// adds a unique constraint on that field, or on that combination of
+// fields, to the table.  From then on Insert and Update return a
+// *dberr.UniqueError for a record that would break the constraint.  It
+// returns one as well if records already in the table break it, and
+// dberr.ErrIndexExists if the table already has that constraint.
+// Constraints are held in memory and need to be created each time the
+// database is opened.
+func (db *Database) CreateUnique(tableName string, fields ...string) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "CreateUnique", Table: tableName})
+
+	if err := db.enter(); err != nil {
+		return err
+	}
+	defer db.exit()
+
+	if len(fields) == 0 {
+		return errors.New("hare: unique constraint needs at least one field")
+	}
+
+	if !db.hasTable(tableName) {
+		return dberr.ErrNoTable
+	}
+
+	if db.isKeyed(tableName) {
+		return dberr.ErrNotSupported
+	}
+
+	lock, err := db.lockTable(tableName)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if db.findUnique(tableName, fields) >= 0 {
+		return dberr.ErrIndexExists
+	}
+
+	u := newUnique(fields)
+
+	err = db.scanTable(tableName, func(id int, rawRec []byte) error {
+		fields, err := db.decodeFields(tableName, rawRec)
+		if err != nil {
+			return err
+		}
+
+		if err := u.check(tableName, id, fields); err != nil {
+			return err
+		}
+
+		u.add(id, fields)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.uniques[tableName] = append(db.uniques[tableName], u)
+
+	return nil
+}
+
+// DropUnique takes a table name and the JSON field names of a unique
+// constraint on the table and removes the constraint.
+func (db *Database) DropUnique(tableName string, fields ...string) (err error) {
+	defer wrapErr(&err, dberr.Error{Op: "DropUnique", Table: tableName})
+
+	if err := db.enter(); err != nil {
+		return err
+	}
+	defer db.exit()
+
+	lock, err := db.lockTable(tableName)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	i := db.findUnique(tableName, fields)
+	if i < 0 {
+		return dberr.ErrNoIndex
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	uniques := db.uniques[tableName]
+	db.uniques[tableName] = append(uniques[:i:i], uniques[i+1:]...)
+
+	return nil
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+// key returns the combination of values a record holds for the
+// constrained fields, or false if the record isn't constrained.
+func (u *unique) key(fields map[string]interface{}) (string, bool) {
+	values := make([]interface{}, len(u.fields))
+
+	for i, field := range u.fields {
+		v := fieldValue(fields, field)
+		if v == nil {
+			return "", false
+		}
+		values[i] = v
+	}
+
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", false
+	}
+
+	return string(b), true
+}
+
+func (u *unique) add(id int, fields map[string]interface{}) {
+	if k, ok := u.key(fields); ok {
+		u.ids[k] = id
+	}
+}
+
+func (u *unique) remove(id int, fields map[string]interface{}) {
+	if k, ok := u.key(fields); ok && u.ids[k] == id {
+		delete(u.ids, k)
+	}
+}
+
+// check returns a *dberr.UniqueError if a record other than the one
+// with the given id already holds the same values.
+func (u *unique) check(tableName string, id int, fields map[string]interface{}) error {
+	k, ok := u.key(fields)
+	if !ok {
+		return nil
+	}
+
+	if otherID, ok := u.ids[k]; ok && otherID != id {
+		return &dberr.UniqueError{Table: tableName, Field: strings.Join(u.fields, ","), ID: otherID}
+	}
+
+	return nil
+}
+
+// checkUniques checks a record's fields against every unique
+// constraint on its table.
+func (db *Database) checkUniques(tableName string, id int, fields map[string]interface{}) error {
+	if fields == nil {
+		return nil
+	}
+
+	for _, u := range db.tableUniques(tableName) {
+		if err := u.check(tableName, id, fields); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findUnique returns the position of the table's unique constraint on
+// exactly the given fields, or -1 if there is none.
+func (db *Database) findUnique(tableName string, fields []string) int {
+	for i, u := range db.tableUniques(tableName) {
+		if strings.Join(u.fields, ",") == strings.Join(fields, ",") {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,160 @@
+package hare
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestUniqueTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//Insert (Unique error)...
+
+			return func(t *testing.T) {
+				if err := db.CreateUnique("contacts", "last_name"); err != nil {
+					t.Fatal(err)
+				}
+
+				_, gotErr := db.Insert("contacts", &Contact{FirstName: "Jane", LastName: "Doe", Age: 30})
+
+				checkErr(t, dberr.ErrUnique, gotErr)
+
+				var uniqueErr *dberr.UniqueError
+				if !errors.As(gotErr, &uniqueErr) {
+					t.Fatalf("want %T; got %T", uniqueErr, gotErr)
+				}
+
+				want := dberr.UniqueError{Table: "contacts", Field: "last_name", ID: 1}
+				if want != *uniqueErr {
+					t.Errorf("want %v; got %v", want, *uniqueErr)
+				}
+
+				if _, err := db.Insert("contacts", &Contact{FirstName: "Jane", LastName: "Roe", Age: 30}); err != nil {
+					t.Fatal(err)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Update (Unique error)...
+
+			return func(t *testing.T) {
+				if err := db.CreateUnique("contacts", "last_name"); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrUnique, db.Update("contacts", &Contact{ID: 3, FirstName: "Bill", LastName: "Keller", Age: 18}))
+
+				// A record may keep its own value.
+				if err := db.Update("contacts", &Contact{ID: 3, FirstName: "William", LastName: "Shakespeare", Age: 18}); err != nil {
+					t.Fatal(err)
+				}
+
+				// Once a value is freed it can be reused.
+				if err := db.Delete("contacts", 4); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.Update("contacts", &Contact{ID: 3, FirstName: "Bill", LastName: "Keller", Age: 18}); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrUnique, db.Update("contacts", &Contact{ID: 2, FirstName: "Abe", LastName: "Keller", Age: 52}))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Unique combination of fields...
+
+			return func(t *testing.T) {
+				if err := db.CreateUnique("contacts", "first_name", "last_name"); err != nil {
+					t.Fatal(err)
+				}
+
+				if _, err := db.Insert("contacts", &Contact{FirstName: "Jane", LastName: "Doe", Age: 30}); err != nil {
+					t.Fatal(err)
+				}
+
+				_, gotErr := db.Insert("contacts", &Contact{FirstName: "John", LastName: "Doe", Age: 30})
+
+				var uniqueErr *dberr.UniqueError
+				if !errors.As(gotErr, &uniqueErr) {
+					t.Fatalf("want %T; got %T", uniqueErr, gotErr)
+				}
+
+				want := "first_name,last_name"
+				got := uniqueErr.Field
+
+				if want != got {
+					t.Errorf("want %v; got %v", want, got)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//CreateUnique (existing records break it)...
+
+			return func(t *testing.T) {
+				if _, err := db.Insert("contacts", &Contact{FirstName: "Jane", LastName: "Doe", Age: 30}); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrUnique, db.CreateUnique("contacts", "last_name"))
+
+				if _, err := db.Insert("contacts", &Contact{FirstName: "Jim", LastName: "Doe", Age: 30}); err != nil {
+					t.Fatal(err)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//DropUnique...
+
+			return func(t *testing.T) {
+				if err := db.CreateUnique("contacts", "last_name"); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrIndexExists, db.CreateUnique("contacts", "last_name"))
+
+				if err := db.DropUnique("contacts", "last_name"); err != nil {
+					t.Fatal(err)
+				}
+
+				if _, err := db.Insert("contacts", &Contact{FirstName: "Jane", LastName: "Doe", Age: 30}); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrNoIndex, db.DropUnique("contacts", "last_name"))
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Tx Commit (Unique error rolls back)...
+
+			return func(t *testing.T) {
+				if err := db.CreateUnique("contacts", "last_name"); err != nil {
+					t.Fatal(err)
+				}
+
+				tx := db.Begin()
+
+				id, err := tx.Insert("contacts", &Contact{FirstName: "Jane", LastName: "Roe", Age: 30})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if _, err := tx.Insert("contacts", &Contact{FirstName: "Jim", LastName: "Roe", Age: 30}); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrUnique, tx.Commit())
+
+				checkErr(t, dberr.ErrNoRecord, db.Find("contacts", id, &Contact{}))
+
+				if _, err := db.Insert("contacts", &Contact{FirstName: "Jane", LastName: "Roe", Age: 30}); err != nil {
+					t.Fatal(err)
+				}
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
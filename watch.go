@@ -0,0 +1,194 @@
+package hare
+
+import (
+	"sync/atomic"
+
+	"github.com/jameycribbs/hare/dberr"
+)
+
+// DefaultWatchBuffer is the number of events a Watcher can hold before
+// new events are dropped, unless WithWatchBuffer says otherwise.
+const DefaultWatchBuffer = 64
+
+// EventKind is the kind of change an Event describes.
+type EventKind int
+
+// The kinds of change a Watcher is told about.
+const (
+	EventInsert EventKind = iota
+	EventUpdate
+	EventDelete
+	EventDrop
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventInsert:
+		return "insert"
+	case EventUpdate:
+		return "update"
+	case EventDelete:
+		return "delete"
+	case EventDrop:
+		return "drop"
+	}
+
+	return "unknown"
+}
+
+// Event describes a change made to a table.  Rec holds the new raw
+// record for inserts and updates, and is nil for deletes and drops.  ID
+// is 0 for drops and for tables with string keys, whose events hold the
+// record's Key instead.
+type Event struct {
+	Kind  EventKind
+	Table string
+	ID    int
+	Key   string
+	Rec   []byte
+}
+
+// Watcher is a subscription to the changes made to a table.  Events
+// are delivered in the order the changes were made.  A Watcher never
+// slows down writes: if its buffer is full, new events are dropped and
+// counted instead.
+type Watcher struct {
+	db        *Database
+	tableName string
+	events    chan Event
+	dropped   atomic.Uint64
+}
+
+// WithWatchBuffer takes a size and returns an Option that sets how many
+// events each Watcher can hold before new events are dropped.  The
+// default is DefaultWatchBuffer.  A negative size is taken as 0, and with
+// a size of 0 every event is dropped unless a receiver is already
+// waiting for it.
+func WithWatchBuffer(size int) Option {
+	return func(db *Database) {
+		if size < 0 {
+			size = 0
+		}
+		db.watchBuffer = size
+	}
+}
+
+// Watch takes a table name and returns a Watcher that is sent an Event
+// after each successful insert, update and delete on the table,
+// including those made by a committed transaction.  When the table is
+// dropped, an EventDrop is sent and the Watcher's channel is closed.
+func (db *Database) Watch(tableName string) (_ *Watcher, err error) {
+	defer wrapErr(&err, dberr.Error{Op: "Watch", Table: tableName})
+
+	if err := db.enter(); err != nil {
+		return nil, err
+	}
+	defer db.exit()
+
+	if !db.hasTable(tableName) {
+		return nil, dberr.ErrNoTable
+	}
+
+	w := &Watcher{db: db, tableName: tableName, events: make(chan Event, db.watchBuffer)}
+
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	db.watchers[tableName] = append(db.watchers[tableName], w)
+
+	return w, nil
+}
+
+// Close ends the subscription and closes the Watcher's channel.
+func (w *Watcher) Close() error {
+	db := w.db
+
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	watchers := db.watchers[w.tableName]
+
+	for i, other := range watchers {
+		if other == w {
+			db.watchers[w.tableName] = append(watchers[:i:i], watchers[i+1:]...)
+			close(w.events)
+			break
+		}
+	}
+
+	return nil
+}
+
+// Dropped returns the number of events that were dropped because the
+// Watcher's buffer was full.
+func (w *Watcher) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+// Events returns the channel the Watcher's events are sent on.
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+//******************************************************************************
+// UNEXPORTED METHODS
+//******************************************************************************
+
+// emit sends an event to every Watcher of its table.  It is called while
+// the table's write lock is held, so that events are sent in the order
+// the changes were made.
+func (db *Database) emit(kind EventKind, tableName string, id int, rawRec []byte) {
+	db.send(Event{Kind: kind, Table: tableName, ID: id, Rec: rawRec})
+}
+
+// emitKeyed is emit for tables with string keys.
+func (db *Database) emitKeyed(kind EventKind, tableName string, key string, rawRec []byte) {
+	db.send(Event{Kind: kind, Table: tableName, Key: key, Rec: rawRec})
+}
+
+// send sends a copy of an event to every Watcher of its table, and closes
+// them if the table has been dropped.
+func (db *Database) send(event Event) {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	tableName := event.Table
+
+	watchers := db.watchers[tableName]
+	if len(watchers) == 0 {
+		return
+	}
+
+	if event.Rec != nil {
+		event.Rec = append([]byte(nil), event.Rec...)
+	}
+
+	for _, w := range watchers {
+		select {
+		case w.events <- event:
+		default:
+			w.dropped.Add(1)
+		}
+	}
+
+	if event.Kind == EventDrop {
+		for _, w := range watchers {
+			close(w.events)
+		}
+		delete(db.watchers, tableName)
+	}
+}
+
+// closeWatchers closes every Watcher of every table.
+func (db *Database) closeWatchers() {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+
+	for _, watchers := range db.watchers {
+		for _, w := range watchers {
+			close(w.events)
+		}
+	}
+
+	db.watchers = make(map[string][]*Watcher)
+}
@@ -0,0 +1,207 @@
+package hare
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/jameycribbs/hare/datastores/ram"
+	"github.com/jameycribbs/hare/dberr"
+)
+
+func TestWatchTests(t *testing.T) {
+	var tests = []func(*Database) func(*testing.T){
+		func(db *Database) func(*testing.T) {
+			//Watch (insert, update, delete, drop)...
+
+			return func(t *testing.T) {
+				w, err := db.Watch("contacts")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				id, err := db.Insert("contacts", &Contact{FirstName: "Jane", LastName: "Roe", Age: 30})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.Update("contacts", &Contact{ID: id, FirstName: "Jane", LastName: "Roe", Age: 31}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := db.Delete("contacts", id); err != nil {
+					t.Fatal(err)
+				}
+
+				checkErr(t, dberr.ErrNoRecord, db.Delete("contacts", id))
+
+				if err := db.DropTable("contacts"); err != nil {
+					t.Fatal(err)
+				}
+
+				var got []string
+				for event := range w.Events() {
+					got = append(got, fmt.Sprintf("%v %v %v %s", event.Kind, event.Table, event.ID, event.Rec))
+				}
+
+				want := []string{
+					`insert contacts 5 {"id":5,"first_name":"Jane","last_name":"Roe","age":30}`,
+					`update contacts 5 {"id":5,"first_name":"Jane","last_name":"Roe","age":31}`,
+					"delete contacts 5 ",
+					"drop contacts 0 ",
+				}
+
+				if fmt.Sprint(want) != fmt.Sprint(got) {
+					t.Errorf("want %v; got %v", want, got)
+				}
+
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Watch (tx commit and rollback)...
+
+			return func(t *testing.T) {
+				w, err := db.Watch("contacts")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer w.Close()
+
+				tx := db.Begin()
+				if _, err := tx.Insert("contacts", &Contact{FirstName: "Jane", LastName: "Roe", Age: 30}); err != nil {
+					t.Fatal(err)
+				}
+				if err := tx.Rollback(); err != nil {
+					t.Fatal(err)
+				}
+
+				// A failed commit is undone and sends no events.
+				tx = db.Begin()
+				if err := tx.Delete("contacts", 1); err != nil {
+					t.Fatal(err)
+				}
+				if err := tx.Delete("contacts", 99); err != nil {
+					t.Fatal(err)
+				}
+				checkErr(t, dberr.ErrNoRecord, tx.Commit())
+
+				tx = db.Begin()
+				if err := tx.Delete("contacts", 1); err != nil {
+					t.Fatal(err)
+				}
+				if err := tx.Commit(); err != nil {
+					t.Fatal(err)
+				}
+
+				want := 1
+				got := len(w.Events())
+				if want != got {
+					t.Fatalf("want %v; got %v", want, got)
+				}
+
+				event := <-w.Events()
+
+				wantEvent := "delete 1"
+				gotEvent := fmt.Sprintf("%v %v", event.Kind, event.ID)
+				if wantEvent != gotEvent {
+					t.Errorf("want %v; got %v", wantEvent, gotEvent)
+				}
+			}
+		},
+		func(db *Database) func(*testing.T) {
+			//Watch (no table)...
+
+			return func(t *testing.T) {
+				_, err := db.Watch("nonexistent")
+				checkErr(t, dberr.ErrNoTable, err)
+			}
+		},
+	}
+
+	runTestFns(t, tests)
+}
+
+func TestWatchBufferTests(t *testing.T) {
+	var tests = []func(t *testing.T){
+		func(t *testing.T) {
+			//WithWatchBuffer (full buffer drops events)...
+
+			r, err := ram.New(seedData())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db, err := New(r, WithWatchBuffer(2))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w, err := db.Watch("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 5; i++ {
+				if _, err := db.Insert("contacts", &Contact{FirstName: "Jane", LastName: "Roe", Age: i}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var want uint64 = 3
+			got := w.Dropped()
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+
+			// Closing the database closes its Watchers.
+			db.Close()
+
+			var ids []int
+			for event := range w.Events() {
+				ids = append(ids, event.ID)
+			}
+
+			wantIDs := "[5 6]"
+			gotIDs := fmt.Sprint(ids)
+			if wantIDs != gotIDs {
+				t.Errorf("want %v; got %v", wantIDs, gotIDs)
+			}
+		},
+		func(t *testing.T) {
+			//WithWatchBuffer (negative size)...
+
+			r, err := ram.New(seedData())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db, err := New(r, WithWatchBuffer(-1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			w, err := db.Watch("contacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := db.Insert("contacts", &Contact{FirstName: "Jane", LastName: "Roe", Age: 1}); err != nil {
+				t.Fatal(err)
+			}
+
+			var want uint64 = 1
+			got := w.Dropped()
+			if want != got {
+				t.Errorf("want %v; got %v", want, got)
+			}
+		},
+	}
+
+	for i, fn := range tests {
+		t.Run(strconv.Itoa(i), fn)
+	}
+}